@@ -0,0 +1,308 @@
+package memecreator
+
+import (
+	"unicode"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// arabicForms maps Arabic letters to their presentation forms in order
+// isolated, final, initial and medial. Zero means letter has no such form,
+// letters without initial form join only to the preceding letter.
+var arabicForms = map[rune][4]rune{
+	'ء': {0xFE80, 0, 0, 0},
+	'آ': {0xFE81, 0xFE82, 0, 0},
+	'أ': {0xFE83, 0xFE84, 0, 0},
+	'ؤ': {0xFE85, 0xFE86, 0, 0},
+	'إ': {0xFE87, 0xFE88, 0, 0},
+	'ئ': {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	'ا': {0xFE8D, 0xFE8E, 0, 0},
+	'ب': {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	'ة': {0xFE93, 0xFE94, 0, 0},
+	'ت': {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	'ث': {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	'ج': {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	'ح': {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	'خ': {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	'د': {0xFEA9, 0xFEAA, 0, 0},
+	'ذ': {0xFEAB, 0xFEAC, 0, 0},
+	'ر': {0xFEAD, 0xFEAE, 0, 0},
+	'ز': {0xFEAF, 0xFEB0, 0, 0},
+	'س': {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	'ش': {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	'ص': {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	'ض': {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	'ط': {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	'ظ': {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	'ع': {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	'غ': {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	'ف': {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	'ق': {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	'ك': {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	'ل': {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	'م': {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	'ن': {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	'ه': {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	'و': {0xFEED, 0xFEEE, 0, 0},
+	'ى': {0xFEEF, 0xFEF0, 0, 0},
+	'ي': {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+}
+
+// lamAlefForms maps alef following lam to isolated and final form of their
+// mandatory ligature.
+var lamAlefForms = map[rune][2]rune{
+	'آ': {0xFEF5, 0xFEF6},
+	'أ': {0xFEF7, 0xFEF8},
+	'إ': {0xFEF9, 0xFEFA},
+	'ا': {0xFEFB, 0xFEFC},
+}
+
+const (
+	arabicLam     = 'ل'
+	arabicTatweel = 'ـ'
+)
+
+const (
+	formIsolated = iota
+	formFinal
+	formInitial
+	formMedial
+)
+
+// isArabicTransparent reports whether rune doesn't take part in joining,
+// such as harakat placed above or below letters.
+func isArabicTransparent(c rune) bool {
+	return unicode.Is(unicode.Mn, c)
+}
+
+// joinsForward reports whether letter joins to the following letter.
+func joinsForward(c rune) bool {
+	if c == arabicTatweel {
+		return true
+	}
+
+	forms, ok := arabicForms[c]
+	return ok && forms[formInitial] != 0
+}
+
+// joinsBackward reports whether letter joins to the preceding letter.
+func joinsBackward(c rune) bool {
+	if c == arabicTatweel {
+		return true
+	}
+
+	forms, ok := arabicForms[c]
+	return ok && forms[formFinal] != 0
+}
+
+// shapeArabic replaces Arabic letters in logical order with contextual
+// presentation forms. Forms without glyph are left as they are so fonts
+// lacking presentation forms still get plain letters.
+func shapeArabic(runes []rune, hasGlyph func(c rune) bool) []rune {
+	// neighbour returns closest non-transparent rune in direction step
+	neighbour := func(i, step int) rune {
+		for j := i + step; j >= 0 && j < len(runes); j += step {
+			if !isArabicTransparent(runes[j]) {
+				return runes[j]
+			}
+		}
+		return 0
+	}
+
+	shaped := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		forms, ok := arabicForms[c]
+		if !ok {
+			shaped = append(shaped, c)
+			continue
+		}
+
+		prev, next := neighbour(i, -1), neighbour(i, 1)
+		joinsPrev := joinsForward(prev) && joinsBackward(c)
+
+		if c == arabicLam {
+			if ligature, ok := lamAlefForms[next]; ok {
+				form := ligature[formIsolated]
+				if joinsPrev {
+					form = ligature[formFinal]
+				}
+
+				if hasGlyph(form) {
+					shaped = append(shaped, form)
+
+					// skip alef, keeping marks between lam and alef
+					for i++; i < len(runes) && runes[i] != next; i++ {
+						shaped = append(shaped, runes[i])
+					}
+					continue
+				}
+			}
+		}
+
+		joinsNext := joinsForward(c) && joinsBackward(next)
+
+		form := forms[formIsolated]
+		switch {
+		case joinsPrev && joinsNext:
+			form = forms[formMedial]
+		case joinsPrev:
+			form = forms[formFinal]
+		case joinsNext:
+			form = forms[formInitial]
+		}
+
+		if form == 0 || !hasGlyph(form) {
+			form = c
+		}
+		shaped = append(shaped, form)
+	}
+
+	return shaped
+}
+
+// strongDirection returns direction of strong character, Neutral for weak
+// and neutral characters.
+func strongDirection(c rune) bidi.Direction {
+	p, _ := bidi.LookupRune(c)
+	switch p.Class() {
+	case bidi.L:
+		return bidi.LeftToRight
+	case bidi.R, bidi.AL:
+		return bidi.RightToLeft
+	}
+
+	return bidi.Neutral
+}
+
+// isRTLDominant reports whether text has more right-to-left than
+// left-to-right strong characters.
+func isRTLDominant(text string) bool {
+	ltr, rtl := 0, 0
+	for _, c := range text {
+		switch strongDirection(c) {
+		case bidi.LeftToRight:
+			ltr++
+		case bidi.RightToLeft:
+			rtl++
+		}
+	}
+
+	return rtl > ltr
+}
+
+// baseDirection returns paragraph direction given by its first strong
+// character, left-to-right for text without any.
+func baseDirection(text string) bidi.Direction {
+	for _, c := range text {
+		if d := strongDirection(c); d != bidi.Neutral {
+			return d
+		}
+	}
+
+	return bidi.LeftToRight
+}
+
+// visualLine shapes Arabic letters and reorders single line from logical to
+// visual order using Unicode Bidirectional Algorithm, so it can be drawn
+// left to right.
+func (r *Renderer) visualLine(text string) string {
+	if !hasRTL(text) {
+		return text
+	}
+
+	base := baseDirection(text)
+	shaped := string(shapeArabic([]rune(text), func(c rune) bool {
+		_, ok := r.opts.Fonts.glyphFont(c)
+		return ok
+	}))
+
+	opts := []bidi.Option{}
+	if base == bidi.RightToLeft {
+		opts = append(opts, bidi.DefaultDirection(bidi.RightToLeft))
+	}
+
+	var p bidi.Paragraph
+	if _, err := p.SetString(shaped, opts...); err != nil {
+		return shaped
+	}
+
+	o, err := p.Order()
+	if err != nil {
+		return shaped
+	}
+
+	runs := make([]bidi.Run, o.NumRuns())
+	for i := range runs {
+		runs[i] = o.Run(i)
+	}
+
+	// runs keep logical order, resolved levels are only known as direction
+	// of each run, right-to-left runs are always one level above base
+	// paragraph and left-to-right runs in right-to-left paragraph too
+	var visual []rune
+	if base == bidi.RightToLeft {
+		for i := len(runs) - 1; i >= 0; i-- {
+			visual = appendRun(visual, runs[i])
+		}
+		return string(visual)
+	}
+
+	for i := 0; i < len(runs); {
+		if runs[i].Direction() != bidi.RightToLeft {
+			visual = appendRun(visual, runs[i])
+			i++
+			continue
+		}
+
+		// numbers between right-to-left runs are embedded in them, so the
+		// whole sequence is reversed as one right-to-left run
+		j := i + 1
+		for j+1 < len(runs) && isNumberRun(runs[j]) && runs[j+1].Direction() == bidi.RightToLeft {
+			j += 2
+		}
+
+		for k := j - 1; k >= i; k-- {
+			visual = appendRun(visual, runs[k])
+		}
+		i = j
+	}
+
+	return string(visual)
+}
+
+// appendRun appends run in visual order, right-to-left runs are reversed
+// with mirrored brackets.
+func appendRun(visual []rune, run bidi.Run) []rune {
+	if run.Direction() == bidi.RightToLeft {
+		return append(visual, []rune(bidi.ReverseString(run.String()))...)
+	}
+
+	return append(visual, []rune(run.String())...)
+}
+
+// isNumberRun reports whether run has only numbers and their separators.
+func isNumberRun(run bidi.Run) bool {
+	for _, c := range run.String() {
+		p, _ := bidi.LookupRune(c)
+		switch p.Class() {
+		case bidi.EN, bidi.AN, bidi.CS, bidi.ES, bidi.ET, bidi.WS:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasRTL reports whether text has any right-to-left character.
+func hasRTL(text string) bool {
+	for _, c := range text {
+		if strongDirection(c) == bidi.RightToLeft {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package memecreator
+
+import "testing"
+
+func TestVisualLine(t *testing.T) {
+	r := testRenderer(t)
+
+	for _, tt := range []struct {
+		logical string
+		visual  string
+	}{
+		{"hello world", "hello world"},
+		{"שלום", "םולש"},
+		{"שלום עולם", "םלוע םולש"},
+		{"hello שלום world", "hello םולש world"},
+		{"שלום hello", "hello םולש"},
+		{"שלום 2024", "2024 םולש"},
+		{"say שלום 42 עולם now", "say םלוע 42 םולש now"},
+		{"(שלום)", "(םולש)"},
+	} {
+		if got := r.visualLine(tt.logical); got != tt.visual {
+			t.Errorf("visual line of %q is %q, want %q", tt.logical, got, tt.visual)
+		}
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	all := func(c rune) bool { return true }
+
+	for _, tt := range []struct {
+		name   string
+		text   string
+		shaped []rune
+	}{
+		// beh initial, medial and final
+		{"dual joining", "ببب", []rune{0xFE91, 0xFE92, 0xFE90}},
+		// alef joins only backward, so following beh is isolated
+		{"right joining", "بان", []rune{0xFE91, 0xFE8E, 0xFEE5}},
+		{"isolated", "ء", []rune{0xFE80}},
+		{"lam alef", "لا", []rune{0xFEFB}},
+		{"lam alef final", "سلا", []rune{0xFEB3, 0xFEFC}},
+		// fatha between letters doesn't break joining
+		{"transparent", "بَب", []rune{0xFE91, 'َ', 0xFE90}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			shaped := shapeArabic([]rune(tt.text), all)
+
+			if string(shaped) != string(tt.shaped) {
+				t.Errorf("shaped %q is %U, want %U", tt.text, shaped, tt.shaped)
+			}
+		})
+	}
+}
+
+func TestShapeArabicMissingGlyphs(t *testing.T) {
+	none := func(c rune) bool { return false }
+
+	if shaped := string(shapeArabic([]rune("سلام"), none)); shaped != "سلام" {
+		t.Errorf("shaped text without presentation forms is %q, want original", shaped)
+	}
+}
+
+func TestIsRTLDominant(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		rtl  bool
+	}{
+		{"hello", false},
+		{"שלום", true},
+		{"שלום hi", true},
+		{"hello world שלום", false},
+		{"123", false},
+	} {
+		if got := isRTLDominant(tt.text); got != tt.rtl {
+			t.Errorf("isRTLDominant(%q) is %v, want %v", tt.text, got, tt.rtl)
+		}
+	}
+}
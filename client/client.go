@@ -0,0 +1,304 @@
+// Package client is typed client of meme creator API. Types mirror JSON of
+// API, so package has no App Engine dependencies and any Go service can use
+// it.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPollInterval is time between meme status checks when waiting for
+// meme without interval.
+const DefaultPollInterval = time.Second
+
+// ErrMemeFailed is returned when waiting for meme worker failed to render.
+var ErrMemeFailed = errors.New("rendering meme failed")
+
+// Client talks to meme creator API running at BaseURL, e.g.
+// https://dh-meme-creator.appspot.com. HTTPClient defaults to
+// http.DefaultClient. Header is sent with every API request, e.g. Cookie of
+// admin session needed for deleting templates.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Header     http.Header
+}
+
+// New creates client of API running at base url.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// UploadTemplateOptions are optional fields of uploaded template. Crop is
+// applied after EXIF orientation, larger templates are scaled down to max
+// dimension.
+type UploadTemplateOptions struct {
+	TopStyle     CaptionStyle
+	BottomStyle  CaptionStyle
+	MaxDimension int
+	Crop         image.Rectangle
+}
+
+// Templates returns all public templates, newest first.
+func (c *Client) Templates(ctx context.Context) ([]*TemplateResponse, error) {
+	var resp struct {
+		Templates []*TemplateResponse `json:"templates"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/templates", "", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Templates, nil
+}
+
+// Template returns template with given id.
+func (c *Client) Template(ctx context.Context, id string) (*TemplateResponse, error) {
+	var resp struct {
+		Template Template `json:"template"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/templates/"+url.PathEscape(id), "", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &TemplateResponse{ID: id, Template: resp.Template}, nil
+}
+
+// UploadTemplate uploads template image read from r and returns id of new
+// template.
+func (c *Client) UploadTemplate(ctx context.Context, filename string, r io.Reader, opts UploadTemplateOptions) (string, error) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+
+	fw, err := mw.CreateFormFile("template", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return "", err
+	}
+
+	fields := url.Values{}
+	captionStyleForm(fields, "top", opts.TopStyle)
+	captionStyleForm(fields, "bottom", opts.BottomStyle)
+	if opts.MaxDimension > 0 {
+		fields.Set("max_dimension", strconv.Itoa(opts.MaxDimension))
+	}
+	if crop := opts.Crop; crop != (image.Rectangle{}) {
+		fields.Set("crop", fmt.Sprintf("%d,%d,%d,%d", crop.Min.X, crop.Min.Y, crop.Dx(), crop.Dy()))
+	}
+	for name, values := range fields {
+		if err := mw.WriteField(name, values[0]); err != nil {
+			return "", err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	return c.create(ctx, "/templates", mw.FormDataContentType(), body)
+}
+
+// DeleteTemplate deletes template with given id, only admins can delete
+// templates, so Header must carry credentials of admin session.
+func (c *Client) DeleteTemplate(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/templates/"+url.PathEscape(id), "", nil, nil)
+}
+
+// CreateMeme queues new meme for rendering and returns its id.
+func (c *Client) CreateMeme(ctx context.Context, cmd *CreateMemeCommand) (string, error) {
+	body, err := json.Marshal(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	return c.create(ctx, "/memes", "application/json", bytes.NewReader(body))
+}
+
+// Memes returns latest memes, newest first.
+func (c *Client) Memes(ctx context.Context) ([]*MemeResponse, error) {
+	var resp struct {
+		Memes []*MemeResponse `json:"memes"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/memes", "", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Memes, nil
+}
+
+// Meme returns meme with given id.
+func (c *Client) Meme(ctx context.Context, id string) (*MemeResponse, error) {
+	var resp struct {
+		Meme *MemeResponse `json:"meme"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/memes/"+url.PathEscape(id), "", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Meme, nil
+}
+
+// WaitMeme polls meme with given id every interval until it is rendered and
+// returns it. Failed memes return ErrMemeFailed together with meme, waiting
+// stops when context is done.
+func (c *Client) WaitMeme(ctx context.Context, id string, interval time.Duration) (*MemeResponse, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		meme, err := c.Meme(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch meme.Status {
+		case MemeStatusDone:
+			return meme, nil
+		case MemeStatusFailed:
+			return meme, ErrMemeFailed
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Download writes rendered meme from its public url to w, variant names
+// other than original download resized variant.
+func (c *Client) Download(ctx context.Context, meme *MemeResponse, variant string, w io.Writer) error {
+	u := meme.PublicURL
+	if variant != "" {
+		var ok bool
+		if u, ok = meme.Variants[variant]; !ok {
+			return fmt.Errorf("meme has no variant %s", variant)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading meme failed, status: %s", resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// create sends body creating resource at path and returns id of created
+// resource from Location header.
+func (c *Client) create(ctx context.Context, p, contentType string, body io.Reader) (string, error) {
+	var location string
+	if err := c.request(ctx, http.MethodPost, p, contentType, body, func(resp *http.Response) error {
+		location = resp.Header.Get("Location")
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	if location == "" {
+		return "", errors.New("created resource has no location")
+	}
+
+	return path.Base(location), nil
+}
+
+// do sends request and decodes JSON response to out when it is not nil.
+func (c *Client) do(ctx context.Context, method, p, contentType string, body io.Reader, out interface{}) error {
+	return c.request(ctx, method, p, contentType, body, func(resp *http.Response) error {
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	})
+}
+
+// request sends request to API and calls handle with successful response,
+// error responses are returned as *APIError.
+func (c *Client) request(ctx context.Context, method, p, contentType string, body io.Reader, handle func(*http.Response) error) error {
+	req, err := http.NewRequest(method, c.BaseURL+p, body)
+	if err != nil {
+		return err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return handle(resp)
+	}
+
+	apiErr := &APIError{Status: resp.StatusCode}
+	data, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Code == "" {
+		apiErr.Code = "http_" + strconv.Itoa(resp.StatusCode)
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+
+	return apiErr
+}
+
+// httpClient returns HTTP client of client or default one.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+// captionStyleForm sets form fields of caption style prefixed by caption
+// name, e.g. top_transform.
+func captionStyleForm(form url.Values, caption string, s CaptionStyle) {
+	if s.Color != "" {
+		form.Set(caption+"_color", s.Color)
+	}
+	if s.Transform != "" {
+		form.Set(caption+"_transform", s.Transform)
+	}
+	if s.Locale != "" {
+		form.Set(caption+"_locale", s.Locale)
+	}
+	if s.LetterSpacing != 0 {
+		form.Set(caption+"_letter_spacing", strconv.FormatFloat(s.LetterSpacing, 'f', -1, 64))
+	}
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateMeme(t *testing.T) {
+	var got CreateMemeCommand
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/memes" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request is %s %s with %q, want JSON POST /memes", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		w.Header().Set("Location", "/memes/meme-1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	cmd := &CreateMemeCommand{
+		TemplateID: "template-1",
+		Top:        "TOP",
+		TopStyle:   CaptionStyle{Color: "#ffcc00"},
+		Output:     OutputFormat{Format: "jpeg", Quality: 80},
+	}
+	id, err := New(server.URL).CreateMeme(context.Background(), cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "meme-1" {
+		t.Errorf("created meme id is %q, want meme-1", id)
+	}
+
+	if got.TemplateID != cmd.TemplateID || got.TopStyle != cmd.TopStyle || got.Output != cmd.Output {
+		t.Errorf("server got command %+v, want %+v", got, cmd)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code":"validation_failed","message":"meme is invalid","details":[{"field":"top","message":"caption is too long"}]}`)
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).CreateMeme(context.Background(), &CreateMemeCommand{})
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("error is %v, want *APIError", err)
+	}
+
+	if apiErr.Status != http.StatusBadRequest || apiErr.Code != "validation_failed" || len(apiErr.Details) != 1 {
+		t.Errorf("error is %+v, want validation error with details", apiErr)
+	}
+}
+
+func TestUploadTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, h, err := r.FormFile("template")
+		if err != nil {
+			t.Errorf("request has no template file, error: %s", err)
+			return
+		}
+		data, _ := ioutil.ReadAll(f)
+
+		if h.Filename != "drake.jpg" || string(data) != "image" {
+			t.Errorf("uploaded file is %s with %q, want drake.jpg with image", h.Filename, data)
+		}
+
+		if v := r.FormValue("top_color"); v != "white" {
+			t.Errorf("top color is %q, want white", v)
+		}
+
+		w.Header().Set("Location", "/templates/template-1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	id, err := New(server.URL).UploadTemplate(context.Background(), "drake.jpg", strings.NewReader("image"), UploadTemplateOptions{
+		TopStyle: CaptionStyle{Color: "white"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != "template-1" {
+		t.Errorf("uploaded template id is %q, want template-1", id)
+	}
+}
+
+func TestWaitMeme(t *testing.T) {
+	polls := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/meme-1.png" {
+			fmt.Fprint(w, "png")
+			return
+		}
+
+		polls++
+		meme := MemeResponse{ID: "meme-1", PublicURL: server.URL + "/meme-1.png"}
+		meme.Status = MemeStatusRendering
+		if polls == 3 {
+			meme.Status = MemeStatusDone
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"meme": meme})
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	meme, err := c.WaitMeme(context.Background(), "meme-1", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if polls != 3 || meme.Status != MemeStatusDone {
+		t.Errorf("meme is %s after %d polls, want done after 3", meme.Status, polls)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Download(context.Background(), meme, "", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "png" {
+		t.Errorf("downloaded meme is %q, want png", buf.String())
+	}
+}
+
+func TestHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/templates/template-1" {
+			t.Errorf("request is %s %s, want DELETE /templates/template-1", r.Method, r.URL.Path)
+		}
+
+		if cookie := r.Header.Get("Cookie"); cookie != "SACSID=admin" {
+			t.Errorf("request has cookie %q, want SACSID=admin", cookie)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Header = http.Header{"Cookie": {"SACSID=admin"}}
+	if err := c.DeleteTemplate(context.Background(), "template-1"); err != nil {
+		t.Fatal(err)
+	}
+}
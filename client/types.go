@@ -0,0 +1,181 @@
+package client
+
+import "time"
+
+// Meme statuses reported by API.
+const (
+	MemeStatusQueued    = "queued"
+	MemeStatusRendering = "rendering"
+	MemeStatusDone      = "done"
+	MemeStatusFailed    = "failed"
+)
+
+// CaptionStyle is style of single caption, empty fields keep defaults of
+// template.
+type CaptionStyle struct {
+	Color         string  `json:"color,omitempty"`
+	Transform     string  `json:"transform,omitempty"`
+	Locale        string  `json:"locale,omitempty"`
+	LetterSpacing float64 `json:"letter_spacing,omitempty"`
+}
+
+// OutputFormat is format of rendered meme. Quality applies to JPEG,
+// compression and colors to PNG formats.
+type OutputFormat struct {
+	Format      string `json:"format,omitempty"`
+	Quality     int    `json:"quality,omitempty"`
+	Compression string `json:"compression,omitempty"`
+	Colors      int    `json:"colors,omitempty"`
+}
+
+// EffectSpec is single image effect applied before or after captions.
+type EffectSpec struct {
+	Name   string  `json:"name"`
+	Stage  string  `json:"stage,omitempty"`
+	Amount float64 `json:"amount,omitempty"`
+}
+
+// OverlaySpec is sticker placed over template, position is relative to
+// template size.
+type OverlaySpec struct {
+	StickerID string  `json:"sticker_id"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Scale     float64 `json:"scale,omitempty"`
+	Rotation  float64 `json:"rotation,omitempty"`
+	Opacity   float64 `json:"opacity,omitempty"`
+}
+
+// Point is position relative to template size.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// QuadSpec is corners of text box drawn in perspective.
+type QuadSpec struct {
+	TopLeft     Point `json:"top_left"`
+	TopRight    Point `json:"top_right"`
+	BottomRight Point `json:"bottom_right"`
+	BottomLeft  Point `json:"bottom_left"`
+}
+
+// TextBoxSpec is caption placed in box over template, given by center, size
+// and rotation or by quad.
+type TextBoxSpec struct {
+	Text     string       `json:"text"`
+	Style    CaptionStyle `json:"style"`
+	X        float64      `json:"x"`
+	Y        float64      `json:"y"`
+	Width    float64      `json:"width"`
+	Height   float64      `json:"height"`
+	Rotation float64      `json:"rotation,omitempty"`
+	Quad     QuadSpec     `json:"quad"`
+}
+
+// PanelSpec is single panel of composed meme.
+type PanelSpec struct {
+	TemplateID  string       `json:"template_id"`
+	Top         string       `json:"top"`
+	Bottom      string       `json:"bottom"`
+	TopStyle    CaptionStyle `json:"top_style"`
+	BottomStyle CaptionStyle `json:"bottom_style"`
+}
+
+// CreateMemeCommand is request creating new meme. Composed memes have
+// templates and captions in panels instead.
+type CreateMemeCommand struct {
+	TemplateID  string        `json:"template_id,omitempty"`
+	FontID      string        `json:"font_id,omitempty"`
+	Top         string        `json:"top"`
+	Bottom      string        `json:"bottom"`
+	TopStyle    CaptionStyle  `json:"top_style"`
+	BottomStyle CaptionStyle  `json:"bottom_style"`
+	Layout      string        `json:"layout,omitempty"`
+	BandColor   string        `json:"band_color,omitempty"`
+	Output      OutputFormat  `json:"output"`
+	Effects     []EffectSpec  `json:"effects,omitempty"`
+	Overlays    []OverlaySpec `json:"overlays,omitempty"`
+	TextBoxes   []TextBoxSpec `json:"text_boxes,omitempty"`
+	Composition string        `json:"composition,omitempty"`
+	Panels      []PanelSpec   `json:"panels,omitempty"`
+	Gutter      *int          `json:"gutter,omitempty"`
+	BorderColor string        `json:"border_color,omitempty"`
+	Variants    []string      `json:"variants,omitempty"`
+}
+
+// Meme is details about meme.
+type Meme struct {
+	Created     time.Time     `json:"created"`
+	Status      string        `json:"status"`
+	TemplateID  string        `json:"template_id"`
+	FontID      string        `json:"font_id"`
+	Top         string        `json:"top"`
+	Bottom      string        `json:"bottom"`
+	TopStyle    CaptionStyle  `json:"top_style"`
+	BottomStyle CaptionStyle  `json:"bottom_style"`
+	Layout      string        `json:"layout,omitempty"`
+	BandColor   string        `json:"band_color,omitempty"`
+	Output      OutputFormat  `json:"output"`
+	Effects     []EffectSpec  `json:"effects,omitempty"`
+	Overlays    []OverlaySpec `json:"overlays,omitempty"`
+	TextBoxes   []TextBoxSpec `json:"text_boxes,omitempty"`
+	Composition string        `json:"composition,omitempty"`
+	Panels      []PanelSpec   `json:"panels,omitempty"`
+	Gutter      int           `json:"gutter,omitempty"`
+	BorderColor string        `json:"border_color,omitempty"`
+	Size        int64         `json:"size"`
+
+	RequestedVariants []string `json:"requested_variants,omitempty"`
+}
+
+// MemeResponse is meme returned by API. Variants map variant names to their
+// public urls.
+type MemeResponse struct {
+	ID string `json:"id"`
+	Meme
+	PublicURL string            `json:"public_url"`
+	Variants  map[string]string `json:"variants"`
+}
+
+// Template is details about template. Caption styles are defaults for memes
+// using template.
+type Template struct {
+	Created     time.Time    `json:"created"`
+	Filename    string       `json:"filename"`
+	Private     bool         `json:"private"`
+	Master      string       `json:"master,omitempty"`
+	TopStyle    CaptionStyle `json:"top_style"`
+	BottomStyle CaptionStyle `json:"bottom_style"`
+}
+
+// TemplateResponse is template returned by API.
+type TemplateResponse struct {
+	ID string `json:"id"`
+	Template
+}
+
+// ValidationError is single invalid field of request.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is error response of API, Status is HTTP status of response.
+type APIError struct {
+	Status    int                `json:"-"`
+	Code      string             `json:"code"`
+	Message   string             `json:"message"`
+	Details   []*ValidationError `json:"details,omitempty"`
+	RequestID string             `json:"request_id,omitempty"`
+}
+
+// Error implements error interface.
+func (e *APIError) Error() string {
+	msg := e.Code + ": " + e.Message
+	for _, d := range e.Details {
+		msg += "; " + d.Field + ": " + d.Message
+	}
+
+	return msg
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/czertbytes/memecreator/client"
+)
+
+// defaultServer is url of API used when neither server flag nor
+// MEMECREATOR_SERVER environment variable is set.
+const defaultServer = "http://localhost:8080"
+
+const apiUsage = `usage: memecreator api [-server url] [-cookie cookie] <resource> <action> [flags] [args]
+
+actions:
+  templates list
+  templates show <id>
+  templates upload [flags] <file>
+  templates delete <id>
+  memes create [flags]
+  memes list
+  memes show <id>
+  memes wait [flags] <id>
+
+deleting templates needs admin session, pass its cookie, e.g.
+SACSID=..., with -cookie flag or MEMECREATOR_COOKIE environment variable
+
+run memecreator api <resource> <action> -h for flags of action
+`
+
+// api runs api command with its command line arguments.
+func api(args []string) error {
+	server := os.Getenv("MEMECREATOR_SERVER")
+	if server == "" {
+		server = defaultServer
+	}
+
+	cookie := os.Getenv("MEMECREATOR_COOKIE")
+
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, apiUsage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&server, "server", server, "`url` of API, defaults to MEMECREATOR_SERVER environment variable")
+	fs.StringVar(&cookie, "cookie", cookie, "`cookie` sent with API requests, defaults to MEMECREATOR_COOKIE environment variable")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c := client.New(server)
+	if cookie != "" {
+		c.Header = http.Header{"Cookie": {cookie}}
+	}
+	ctx := context.Background()
+	action, args := fs.Arg(0)+" "+fs.Arg(1), fs.Args()[2:]
+
+	switch action {
+	case "templates list":
+		templates, err := c.Templates(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(templates)
+	case "templates show":
+		id, err := idArg(action, args)
+		if err != nil {
+			return err
+		}
+		template, err := c.Template(ctx, id)
+		if err != nil {
+			return err
+		}
+		return printJSON(template)
+	case "templates upload":
+		return uploadTemplate(ctx, c, args)
+	case "templates delete":
+		id, err := idArg(action, args)
+		if err != nil {
+			return err
+		}
+		return c.DeleteTemplate(ctx, id)
+	case "memes create":
+		return createMeme(ctx, c, args)
+	case "memes list":
+		memes, err := c.Memes(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(memes)
+	case "memes show":
+		id, err := idArg(action, args)
+		if err != nil {
+			return err
+		}
+		meme, err := c.Meme(ctx, id)
+		if err != nil {
+			return err
+		}
+		return printJSON(meme)
+	case "memes wait":
+		return waitMeme(ctx, c, args)
+	}
+
+	fs.Usage()
+	os.Exit(2)
+	return nil
+}
+
+// uploadTemplate runs templates upload action and prints id of template.
+func uploadTemplate(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("templates upload", flag.ExitOnError)
+	var opts client.UploadTemplateOptions
+	fs.StringVar(&opts.TopStyle.Color, "top-color", "", "default `color` of top caption")
+	fs.StringVar(&opts.TopStyle.Transform, "top-transform", "", "default text transform of top caption")
+	fs.StringVar(&opts.BottomStyle.Color, "bottom-color", "", "default `color` of bottom caption")
+	fs.StringVar(&opts.BottomStyle.Transform, "bottom-transform", "", "default text transform of bottom caption")
+	fs.IntVar(&opts.MaxDimension, "max-dimension", 0, "maximum width and height of template in `pixels`")
+	crop := fs.String("crop", "", "crop template to `x,y,width,height`")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("templates upload needs single template file")
+	}
+
+	if *crop != "" {
+		var x, y, w, h int
+		if _, err := fmt.Sscanf(*crop, "%d,%d,%d,%d", &x, &y, &w, &h); err != nil {
+			return fmt.Errorf("parsing crop failed, error: %s", err)
+		}
+		opts.Crop = image.Rect(x, y, x+w, y+h)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	id, err := c.UploadTemplate(ctx, filepath.Base(fs.Arg(0)), f, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(id)
+	return nil
+}
+
+// createMeme runs memes create action. Command is read from JSON file and
+// flags override its fields, id of meme is printed unless meme is waited
+// for and downloaded.
+func createMeme(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("memes create", flag.ExitOnError)
+	file := fs.String("json", "", "read command from JSON `file`, - reads standard input")
+	templateID := fs.String("template", "", "template `id`")
+	font := fs.String("font", "", "font `id`")
+	top := fs.String("top", "", "top caption")
+	bottom := fs.String("bottom", "", "bottom caption")
+	topColor := fs.String("top-color", "", "`color` of top caption")
+	bottomColor := fs.String("bottom-color", "", "`color` of bottom caption")
+	layout := fs.String("layout", "", "caption layout, overlay or bands")
+	bandColor := fs.String("band-color", "", "background `color` of bands layout")
+	format := fs.String("format", "", "output format png, png8, jpeg or svg")
+	quality := fs.Int("quality", 0, "JPEG `quality` from 1 to 100")
+	effects := fs.String("effects", "", "effects as JSON array")
+	overlays := fs.String("overlays", "", "overlays as JSON array")
+	textBoxes := fs.String("text-boxes", "", "text boxes as JSON array")
+	wait := fs.Bool("wait", false, "wait until meme is rendered and download it")
+	w := waitFlags(fs)
+	fs.Parse(args)
+
+	var cmd client.CreateMemeCommand
+	if *file != "" {
+		if err := readJSON(*file, &cmd); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "template":
+			cmd.TemplateID = *templateID
+		case "font":
+			cmd.FontID = *font
+		case "top":
+			cmd.Top = *top
+		case "bottom":
+			cmd.Bottom = *bottom
+		case "top-color":
+			cmd.TopStyle.Color = *topColor
+		case "bottom-color":
+			cmd.BottomStyle.Color = *bottomColor
+		case "layout":
+			cmd.Layout = *layout
+		case "band-color":
+			cmd.BandColor = *bandColor
+		case "format":
+			cmd.Output.Format = *format
+		case "quality":
+			cmd.Output.Quality = *quality
+		case "effects":
+			err = jsonFlag(err, f.Name, *effects, &cmd.Effects)
+		case "overlays":
+			err = jsonFlag(err, f.Name, *overlays, &cmd.Overlays)
+		case "text-boxes":
+			err = jsonFlag(err, f.Name, *textBoxes, &cmd.TextBoxes)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	id, err := c.CreateMeme(ctx, &cmd)
+	if err != nil {
+		return err
+	}
+
+	if !*wait {
+		fmt.Println(id)
+		return nil
+	}
+
+	return w.run(ctx, c, id)
+}
+
+// waitMeme runs memes wait action.
+func waitMeme(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("memes wait", flag.ExitOnError)
+	w := waitFlags(fs)
+	fs.Parse(args)
+
+	id, err := idArg("memes wait", fs.Args())
+	if err != nil {
+		return err
+	}
+
+	return w.run(ctx, c, id)
+}
+
+// waitOptions are flags of waiting for meme and downloading it.
+type waitOptions struct {
+	interval *time.Duration
+	timeout  *time.Duration
+	variant  *string
+	out      *string
+}
+
+// waitFlags defines flags of waiting for meme in flag set.
+func waitFlags(fs *flag.FlagSet) *waitOptions {
+	return &waitOptions{
+		interval: fs.Duration("interval", client.DefaultPollInterval, "time between status checks"),
+		timeout:  fs.Duration("timeout", 2*time.Minute, "maximum time of waiting"),
+		variant:  fs.String("variant", "", "download resized variant `name` instead of original"),
+		out:      fs.String("o", "", "output `file`, - writes standard output, defaults to name of meme object"),
+	}
+}
+
+// run polls meme until it is rendered and downloads it to output file.
+func (o *waitOptions) run(ctx context.Context, c *client.Client, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, *o.timeout)
+	defer cancel()
+
+	meme, err := c.WaitMeme(ctx, id, *o.interval)
+	if err != nil {
+		return fmt.Errorf("waiting for meme %s failed, error: %s", id, err)
+	}
+
+	out := *o.out
+	if out == "" {
+		out = path.Base(meme.PublicURL)
+	}
+
+	if out == "-" {
+		return c.Download(ctx, meme, *o.variant, os.Stdout)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	// partially downloaded memes are removed
+	if err := c.Download(ctx, meme, *o.variant, f); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, out)
+	return nil
+}
+
+// idArg returns single id argument of action.
+func idArg(action string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%s needs single id argument", action)
+	}
+
+	return args[0], nil
+}
+
+// jsonFlag parses JSON value of flag to v unless previous flag failed.
+func jsonFlag(err error, name, value string, v interface{}) error {
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		return fmt.Errorf("parsing %s failed, error: %s", name, err)
+	}
+
+	return nil
+}
+
+// readJSON decodes JSON file to v, - reads standard input.
+func readJSON(name string, v interface{}) error {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("parsing %s failed, error: %s", name, err)
+	}
+
+	return nil
+}
+
+// printJSON writes v as indented JSON to standard output.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,52 @@
+// Command memecreator renders memes from local files without running App
+// Engine app and manages templates and memes of running server.
+//
+// Usage:
+//
+//	memecreator render -template drake.jpg -top "..." -bottom "..." -o out.png
+//	memecreator render -batch memes.csv -o out/
+//	cat drake.jpg | memecreator render -template - -top "..." > out.png
+//	memecreator api memes create -template <id> -top "..." -wait -o out.png
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+const usage = `usage: memecreator <command> [flags]
+
+commands:
+  render    render meme or batch of memes from local files
+  api       manage templates and memes of running server
+
+run memecreator <command> -h for flags of command
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("memecreator: ")
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "render":
+		err = render(os.Args[2:])
+	case "api":
+		err = api(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
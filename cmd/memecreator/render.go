@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/czertbytes/memecreator"
+)
+
+// renderFlags maps flags of render command to fields of create meme form,
+// so flags, CSV columns and JSONL keys have the same meaning as in API.
+var renderFlags = []struct {
+	name  string
+	field string
+	usage string
+}{
+	{"template", "template", "template image `file`, - reads standard input"},
+	{"o", "out", "output `file`, - or none writes standard output, directory of outputs in batch"},
+	{"top", "top", "top caption"},
+	{"bottom", "bottom", "bottom caption"},
+	{"font", "font_id", "builtin font `id` or path to TrueType file"},
+	{"layout", "layout", "caption layout, overlay or bands"},
+	{"band-color", "band_color", "background `color` of bands layout"},
+	{"top-color", "top_color", "`color` of top caption"},
+	{"top-transform", "top_transform", "text transform of top caption"},
+	{"top-locale", "top_locale", "`locale` of top caption"},
+	{"top-letter-spacing", "top_letter_spacing", "letter spacing of top caption in `ems`"},
+	{"bottom-color", "bottom_color", "`color` of bottom caption"},
+	{"bottom-transform", "bottom_transform", "text transform of bottom caption"},
+	{"bottom-locale", "bottom_locale", "`locale` of bottom caption"},
+	{"bottom-letter-spacing", "bottom_letter_spacing", "letter spacing of bottom caption in `ems`"},
+	{"format", "format", "output format png, png8, jpeg or svg, defaults to output file extension"},
+	{"quality", "quality", "JPEG `quality` from 1 to 100"},
+	{"compression", "compression", "PNG compression"},
+	{"colors", "colors", "number of png8 palette `colors`"},
+	{"effects", "effects", "effects as JSON array"},
+	{"overlays", "overlays", "overlays as JSON array, sticker ids are image files"},
+	{"text-boxes", "text_boxes", "text boxes as JSON array"},
+	{"composition", "composition", "composition of panels, grid, strip or stack"},
+	{"panels", "panels", "panels as JSON array, template ids are image files"},
+	{"gutter", "gutter", "space between panels in `pixels`"},
+	{"border-color", "border_color", "`color` of space between panels"},
+}
+
+// render runs render command with its command line arguments.
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	values := make(map[string]*string, len(renderFlags))
+	for _, f := range renderFlags {
+		values[f.field] = fs.String(f.name, "", f.usage)
+	}
+	batch := fs.String("batch", "", "render every row of CSV or JSONL `file` with flags as defaults, - reads standard input")
+	batchFormat := fs.String("batch-format", "", "format of batch file, csv or jsonl, defaults to its extension")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %s", strings.Join(fs.Args(), " "))
+	}
+
+	form := make(url.Values)
+	for field, v := range values {
+		if *v != "" {
+			form[field] = []string{*v}
+		}
+	}
+
+	if *batch != "" {
+		return renderBatch(*batch, *batchFormat, form)
+	}
+
+	job, err := memecreator.RenderJobFromForm(form)
+	if err != nil {
+		return err
+	}
+
+	return renderJob(job, loadImage)
+}
+
+// renderJob validates and renders single job to its output file, images are
+// loaded with load.
+func renderJob(job *memecreator.RenderJob, load func(path string) (image.Image, error)) error {
+	if job.Output.Format == "" {
+		job.Output.Format = formatFromExtension(job.Out)
+	}
+
+	if errs := job.Validate(); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Field + ": " + e.Message
+		}
+		return fmt.Errorf("invalid meme, %s", strings.Join(msgs, "; "))
+	}
+
+	if job.Out == "" || job.Out == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := job.Render(w, load); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	f, err := os.Create(job.Out)
+	if err != nil {
+		return err
+	}
+
+	// partially written memes are removed
+	if err := job.Render(f, load); err != nil {
+		f.Close()
+		os.Remove(job.Out)
+		return err
+	}
+
+	return f.Close()
+}
+
+// renderBatch renders every row of CSV or JSONL batch file. Values of form
+// from flags are defaults of rows and out flag is created directory of
+// relative output files. Failed rows are logged and rendering continues.
+func renderBatch(path, format string, form url.Values) error {
+	var r io.Reader = os.Stdin
+	load := loadImage
+	if path == "-" {
+		// standard input is batch file, rows can't read images from it
+		load = func(imagePath string) (image.Image, error) {
+			if imagePath == "-" {
+				return nil, fmt.Errorf("standard input is used by batch file, image must be a file")
+			}
+			return loadImage(imagePath)
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if format == "" {
+		format = "jsonl"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	}
+
+	outDir := ""
+	if out, ok := form["out"]; ok {
+		outDir = out[0]
+		delete(form, "out")
+
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	total, failed := 0, 0
+	jobs := func(line int, job *memecreator.RenderJob, err error) {
+		total++
+		if err == nil {
+			if job.Out == "" {
+				err = fmt.Errorf("output file is required")
+			} else {
+				if outDir != "" && !filepath.IsAbs(job.Out) {
+					job.Out = filepath.Join(outDir, job.Out)
+				}
+				err = renderJob(job, load)
+			}
+		}
+
+		if err != nil {
+			log.Printf("%s:%d: %s", path, line, err)
+			failed++
+		}
+	}
+
+	var err error
+	switch format {
+	case "csv":
+		err = readCSVJobs(r, form, jobs)
+	case "jsonl":
+		err = readJSONLJobs(r, form, jobs)
+	default:
+		return fmt.Errorf("batch format must be csv or jsonl")
+	}
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d memes failed", failed, total)
+	}
+
+	return nil
+}
+
+// readCSVJobs calls fn with job of every row of CSV with header of form
+// field names. Empty cells keep default values of form.
+func readCSVJobs(r io.Reader, form url.Values, fn func(line int, job *memecreator.RenderJob, err error)) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading csv header failed, error: %s", err)
+	}
+
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading csv failed, error: %s", err)
+		}
+
+		rowForm := make(url.Values, len(form)+len(record))
+		for field, v := range form {
+			rowForm[field] = v
+		}
+		for i, cell := range record {
+			if i < len(header) && cell != "" {
+				rowForm[strings.TrimSpace(header[i])] = []string{cell}
+			}
+		}
+
+		job, err := memecreator.RenderJobFromForm(rowForm)
+		fn(line, job, err)
+	}
+}
+
+// readJSONLJobs calls fn with job of every JSON object line, keys missing
+// in object keep default values of form.
+func readJSONLJobs(r io.Reader, form url.Values, fn func(line int, job *memecreator.RenderJob, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		job, err := memecreator.RenderJobFromForm(form)
+		if err == nil {
+			if err = json.Unmarshal([]byte(data), job); err != nil {
+				err = fmt.Errorf("parsing json failed, error: %s", err)
+			}
+		}
+
+		fn(line, job, err)
+	}
+
+	return scanner.Err()
+}
+
+// formatFromExtension returns output format of file name extension.
+func formatFromExtension(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return memecreator.FormatJPEG
+	case ".svg":
+		return memecreator.FormatSVG
+	}
+
+	return memecreator.FormatPNG
+}
+
+// loadImage decodes template or sticker image file, - reads standard input.
+var loadImage = newImageLoader(os.Stdin)
+
+// newImageLoader returns function decoding image files. Image read from
+// stdin for path - is decoded once and returned for every following -, so
+// template, panels and stickers of all jobs can use it.
+func newImageLoader(stdin io.Reader) func(path string) (image.Image, error) {
+	var once sync.Once
+	var stdinImage image.Image
+	var stdinErr error
+
+	return func(path string) (image.Image, error) {
+		if path == "-" {
+			once.Do(func() {
+				stdinImage, stdinErr = decodeImage(stdin, path)
+			})
+			return stdinImage, stdinErr
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return decodeImage(f, path)
+	}
+}
+
+// decodeImage decodes image like uploaded templates.
+func decodeImage(r io.Reader, path string) (image.Image, error) {
+	img, err := memecreator.DecodeTemplate(r)
+	if err != nil {
+		return nil, fmt.Errorf("loading image %s failed, error: %s", path, err)
+	}
+
+	return img, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/czertbytes/memecreator"
+)
+
+// batchRow is job or error passed for single row of batch file.
+type batchRow struct {
+	line int
+	job  *memecreator.RenderJob
+	err  error
+}
+
+// collectRows returns callback collecting rows of batch file.
+func collectRows(rows *[]batchRow) func(line int, job *memecreator.RenderJob, err error) {
+	return func(line int, job *memecreator.RenderJob, err error) {
+		*rows = append(*rows, batchRow{line, job, err})
+	}
+}
+
+func TestReadCSVJobs(t *testing.T) {
+	defaults := url.Values{
+		"top":     []string{"DEFAULT TOP"},
+		"font_id": []string{"go-bold"},
+	}
+	csv := "template, out,top,bottom,gutter\n" +
+		"a.png,a.png,ONE,,\n" +
+		"b.png,b.jpg,,TWO,0\n" +
+		"c.png,c.png,,,wide\n"
+
+	var rows []batchRow
+	if err := readCSVJobs(strings.NewReader(csv), defaults, collectRows(&rows)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("csv has %d rows, want 3", len(rows))
+	}
+
+	for i, want := range []struct {
+		line                       int
+		template, out, top, bottom string
+	}{
+		{2, "a.png", "a.png", "ONE", ""},
+		{3, "b.png", "b.jpg", "DEFAULT TOP", "TWO"},
+	} {
+		row := rows[i]
+		if row.err != nil {
+			t.Errorf("row %d has error %s", i, row.err)
+			continue
+		}
+
+		job := row.job
+		if row.line != want.line || job.Template != want.template || job.Out != want.out || job.Top != want.top || job.Bottom != want.bottom {
+			t.Errorf("row %d is line %d %q %q %q %q, want line %d %q %q %q %q", i, row.line, job.Template, job.Out, job.Top, job.Bottom, want.line, want.template, want.out, want.top, want.bottom)
+		}
+
+		if job.FontID != "go-bold" {
+			t.Errorf("row %d has font %q, want default go-bold", i, job.FontID)
+		}
+	}
+
+	if g := rows[1].job.Gutter; g == nil || *g != 0 {
+		t.Errorf("explicit zero gutter is %v, want 0", g)
+	}
+
+	if rows[2].line != 4 || rows[2].err == nil {
+		t.Errorf("row with invalid gutter is line %d with error %v, want line 4 with error", rows[2].line, rows[2].err)
+	}
+
+	// rows don't change defaults shared by all rows
+	if got := defaults.Get("top"); got != "DEFAULT TOP" {
+		t.Errorf("default top changed to %q", got)
+	}
+}
+
+func TestReadJSONLJobs(t *testing.T) {
+	defaults := url.Values{
+		"top":    []string{"DEFAULT TOP"},
+		"gutter": []string{"20"},
+	}
+	jsonl := `{"template": "a.png", "out": "a.png", "bottom": "ONE"}` + "\n" +
+		"\n" +
+		`{"template": "b.png", "out": "b.png", "top": "TWO", "gutter": 0}` + "\n" +
+		`{"template": ` + "\n"
+
+	var rows []batchRow
+	if err := readJSONLJobs(strings.NewReader(jsonl), defaults, collectRows(&rows)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("jsonl has %d rows, want 3", len(rows))
+	}
+
+	first, second := rows[0].job, rows[1].job
+	if rows[0].err != nil || rows[1].err != nil {
+		t.Fatalf("rows have errors %v and %v", rows[0].err, rows[1].err)
+	}
+
+	if rows[0].line != 1 || first.Template != "a.png" || first.Top != "DEFAULT TOP" || first.Bottom != "ONE" {
+		t.Errorf("first row is line %d %q %q %q, want line 1 a.png with default top", rows[0].line, first.Template, first.Top, first.Bottom)
+	}
+
+	// empty line is skipped but counted
+	if rows[1].line != 3 || second.Top != "TWO" {
+		t.Errorf("second row is line %d with top %q, want line 3 with top TWO", rows[1].line, second.Top)
+	}
+
+	if first.Gutter == nil || *first.Gutter != 20 {
+		t.Errorf("default gutter is %v, want 20", first.Gutter)
+	}
+	if second.Gutter == nil || *second.Gutter != 0 {
+		t.Errorf("explicit zero gutter is %v, want 0", second.Gutter)
+	}
+
+	if rows[2].line != 4 || rows[2].err == nil {
+		t.Errorf("malformed row is line %d with error %v, want line 4 with error", rows[2].line, rows[2].err)
+	}
+}
+
+func TestImageLoaderReadsStdinOnce(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+
+	load := newImageLoader(&buf)
+	first, err := load("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := load("-")
+	if err != nil {
+		t.Fatalf("loading standard input again failed, error: %s", err)
+	}
+
+	if first != second {
+		t.Errorf("standard input is decoded again")
+	}
+
+	if _, err := load("missing.png"); err == nil {
+		t.Errorf("loading missing file succeeded")
+	}
+}
@@ -0,0 +1,276 @@
+package memecreator
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// CompositionGrid tiles panels in rows of two.
+	CompositionGrid = "grid"
+
+	// CompositionStrip places panels side by side in single row.
+	CompositionStrip = "strip"
+
+	// CompositionStack places panels under each other in single column.
+	CompositionStack = "stack"
+
+	// MaxPanels is maximum number of panels of single meme.
+	MaxPanels = 4
+
+	// DefaultGutter is space between panels and around them in pixels when
+	// no gutter is given.
+	DefaultGutter = 10
+
+	// MaxGutter is maximum space between panels in pixels.
+	MaxGutter = 100
+)
+
+// PanelSpec is type used for storing single panel of composed meme. Panel
+// styles override default styles of its template.
+type PanelSpec struct {
+	TemplateID  string       `json:"template_id"`
+	Top         string       `json:"top"`
+	Bottom      string       `json:"bottom"`
+	TopStyle    CaptionStyle `json:"top_style"`
+	BottomStyle CaptionStyle `json:"bottom_style"`
+}
+
+// ComposePanels tiles panels into columns with gutter pixels between them
+// and around them filled with border color. Panels in single row are scaled
+// to the same height, otherwise to the same width and centered vertically
+// in their row. Panels are scaled down to the smallest one, never up.
+func ComposePanels(panels []image.Image, columns, gutter int, border color.Color) draw.Image {
+	if len(panels) == 0 {
+		return image.NewNRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	if columns < 1 || columns > len(panels) {
+		columns = len(panels)
+	}
+	rows := (len(panels) + columns - 1) / columns
+
+	// panels are scaled to common width, or height when there is one row
+	common := 0
+	for i, p := range panels {
+		n := p.Bounds().Dx()
+		if rows == 1 {
+			n = p.Bounds().Dy()
+		}
+		if i == 0 || n < common {
+			common = n
+		}
+	}
+
+	sizes := make([]image.Point, len(panels))
+	for i, p := range panels {
+		b := p.Bounds()
+		if rows == 1 {
+			sizes[i] = image.Pt(divRound(b.Dx()*common, b.Dy()), common)
+		} else {
+			sizes[i] = image.Pt(common, divRound(b.Dy()*common, b.Dx()))
+		}
+	}
+
+	widths := make([]int, columns)
+	heights := make([]int, rows)
+	for i, size := range sizes {
+		if col := i % columns; size.X > widths[col] {
+			widths[col] = size.X
+		}
+		if row := i / columns; size.Y > heights[row] {
+			heights[row] = size.Y
+		}
+	}
+
+	width, height := gutter, gutter
+	for _, w := range widths {
+		width += w + gutter
+	}
+	for _, h := range heights {
+		height += h + gutter
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(border), image.Point{}, draw.Src)
+
+	y := gutter
+	for row, h := range heights {
+		x := gutter
+		for col, w := range widths {
+			i := row*columns + col
+			if i >= len(panels) {
+				break
+			}
+
+			size := sizes[i]
+			min := image.Pt(x+(w-size.X)/2, y+(h-size.Y)/2)
+			cell := image.Rectangle{Min: min, Max: min.Add(size)}
+			if size == panels[i].Bounds().Size() {
+				draw.Draw(dst, cell, panels[i], panels[i].Bounds().Min, draw.Src)
+			} else {
+				xdraw.CatmullRom.Scale(dst, cell, panels[i], panels[i].Bounds(), draw.Src, nil)
+			}
+
+			x += w + gutter
+		}
+		y += h + gutter
+	}
+
+	return dst
+}
+
+// divRound returns a/b rounded to nearest integer.
+func divRound(a, b int) int {
+	return (a + b/2) / b
+}
+
+// compositionColumns returns number of columns of composition mode.
+func compositionColumns(composition string, panels int) int {
+	switch composition {
+	case CompositionGrid:
+		return 2
+	case CompositionStack:
+		return 1
+	}
+
+	return panels
+}
+
+// panels returns panels of meme, memes without composition have their
+// template and captions as single panel.
+func (m *Meme) panels() []PanelSpec {
+	if len(m.Panels) > 0 {
+		return m.Panels
+	}
+
+	return []PanelSpec{{
+		TemplateID:  m.TemplateID,
+		Top:         m.Top,
+		Bottom:      m.Bottom,
+		TopStyle:    m.TopStyle,
+		BottomStyle: m.BottomStyle,
+	}}
+}
+
+// composePanels tiles rendered panels of meme using its composition, memes
+// with single panel are returned as they are.
+func (m *Meme) composePanels(panels []draw.Image) draw.Image {
+	if len(m.Panels) == 0 && len(panels) == 1 {
+		return panels[0]
+	}
+
+	border, ok := parseColor(m.BorderColor)
+	if !ok {
+		border = color.White
+	}
+
+	images := make([]image.Image, len(panels))
+	for i, p := range panels {
+		images[i] = p
+	}
+
+	return ComposePanels(images, compositionColumns(m.Composition, len(panels)), m.Gutter, border)
+}
+
+// gutter returns gutter of composed meme, memes without panels have none
+// and composed memes without gutter in command use DefaultGutter.
+func (cmd *CreateMemeCommand) gutter() int {
+	switch {
+	case len(cmd.Panels) == 0 && cmd.Composition == "":
+		return 0
+	case cmd.Gutter == nil:
+		return DefaultGutter
+	}
+
+	return *cmd.Gutter
+}
+
+// validatePanels checks composition of meme and captions and styles of its
+// panels. Templates of panels are checked with templates of memes.
+func validatePanels(cmd *CreateMemeCommand) []*ValidationError {
+	var errs []*ValidationError
+
+	if cmd.Composition == "" && len(cmd.Panels) == 0 {
+		return nil
+	}
+
+	switch cmd.Composition {
+	case CompositionGrid, CompositionStrip, CompositionStack:
+	default:
+		errs = append(errs, &ValidationError{
+			Field:   "composition",
+			Message: "composition must be one of grid, strip or stack",
+		})
+	}
+
+	if len(cmd.Panels) < 2 || len(cmd.Panels) > MaxPanels {
+		errs = append(errs, &ValidationError{
+			Field:   "panels",
+			Message: fmt.Sprintf("composition must have from 2 to %d panels", MaxPanels),
+		})
+	}
+
+	if cmd.TemplateID != "" || cmd.Top != "" || cmd.Bottom != "" {
+		errs = append(errs, &ValidationError{
+			Field:   "panels",
+			Message: "panels can't be combined with template id or captions of meme",
+		})
+	}
+
+	if cmd.Output.Format == FormatSVG {
+		errs = append(errs, &ValidationError{
+			Field:   "output.format",
+			Message: "svg format is not supported for composed memes",
+		})
+	}
+
+	if cmd.Gutter != nil && !(*cmd.Gutter >= 0 && *cmd.Gutter <= MaxGutter) {
+		errs = append(errs, &ValidationError{
+			Field:   "gutter",
+			Message: fmt.Sprintf("gutter must be between 0 and %d pixels", MaxGutter),
+		})
+	}
+
+	if _, ok := parseColor(cmd.BorderColor); cmd.BorderColor != "" && !ok {
+		errs = append(errs, &ValidationError{
+			Field:   "border_color",
+			Message: "border color must be white, black or hex color like #ffcc00",
+		})
+	}
+
+	for i, p := range cmd.Panels {
+		field := fmt.Sprintf("panels[%d]", i)
+
+		if p.TemplateID == "" {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".template_id",
+				Message: "template id is required",
+			})
+		}
+
+		for _, caption := range []struct {
+			field string
+			text  string
+		}{
+			{field + ".top", p.Top},
+			{field + ".bottom", p.Bottom},
+		} {
+			if err := validateCaption(caption.text); err != "" {
+				errs = append(errs, &ValidationError{
+					Field:   caption.field,
+					Message: err,
+				})
+			}
+		}
+
+		errs = append(errs, validateCaptionStyle(field+".top_style", p.TopStyle)...)
+		errs = append(errs, validateCaptionStyle(field+".bottom_style", p.BottomStyle)...)
+	}
+
+	return errs
+}
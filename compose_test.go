@@ -0,0 +1,86 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestComposePanels(t *testing.T) {
+	black := color.NRGBA{A: 255}
+	for _, tt := range []struct {
+		name    string
+		panels  []image.Image
+		columns int
+		size    image.Point
+	}{
+		{"grid", []image.Image{testSticker(100, 50), testSticker(100, 50), testSticker(100, 50), testSticker(100, 50)}, 2, image.Pt(230, 130)},
+		{"strip scales to lowest", []image.Image{testSticker(100, 50), testSticker(200, 200), testSticker(50, 50)}, 3, image.Pt(240, 70)},
+		{"stack scales to narrowest", []image.Image{testSticker(100, 50), testSticker(200, 200)}, 1, image.Pt(120, 180)},
+		{"grid with odd panel", []image.Image{testSticker(100, 50), testSticker(100, 50), testSticker(100, 50)}, 2, image.Pt(230, 130)},
+	} {
+		img := ComposePanels(tt.panels, tt.columns, 10, black)
+		if got := img.Bounds().Size(); got != tt.size {
+			t.Errorf("%s: composed image is %v, want %v", tt.name, got, tt.size)
+			continue
+		}
+
+		// gutter around panels has border color, panels are red
+		if c := color.NRGBAModel.Convert(img.At(5, 5)); c != black {
+			t.Errorf("%s: gutter is %v, want border color", tt.name, c)
+		}
+		if c := color.NRGBAModel.Convert(img.At(15, 15)).(color.NRGBA); c.R != 255 {
+			t.Errorf("%s: first panel is %v, want red", tt.name, c)
+		}
+	}
+}
+
+func TestValidatePanels(t *testing.T) {
+	panels := []PanelSpec{{TemplateID: "a", Top: "one"}, {TemplateID: "b", Bottom: "two"}}
+	wide, none := 500, 0
+	for _, tt := range []struct {
+		name string
+		cmd  CreateMemeCommand
+		errs int
+	}{
+		{"no composition", CreateMemeCommand{TemplateID: "a", Top: "top"}, 0},
+		{"grid", CreateMemeCommand{Composition: CompositionGrid, Panels: panels}, 0},
+		{"unknown composition", CreateMemeCommand{Composition: "mosaic", Panels: panels}, 1},
+		{"single panel", CreateMemeCommand{Composition: CompositionStack, Panels: panels[:1]}, 1},
+		{"with template", CreateMemeCommand{Composition: CompositionStrip, Panels: panels, TemplateID: "a"}, 1},
+		{"gutter and border", CreateMemeCommand{Composition: CompositionStrip, Panels: panels, Gutter: &wide, BorderColor: "pink"}, 2},
+		{"zero gutter", CreateMemeCommand{Composition: CompositionStrip, Panels: panels, Gutter: &none}, 0},
+		{"panel without template", CreateMemeCommand{Composition: CompositionGrid, Panels: []PanelSpec{{}, {TemplateID: "b"}}}, 1},
+	} {
+		if errs := validatePanels(&tt.cmd); len(errs) != tt.errs {
+			t.Errorf("%s: %d errors, want %d", tt.name, len(errs), tt.errs)
+		}
+	}
+}
+
+func TestCreateMemeCommandGutter(t *testing.T) {
+	panels := []PanelSpec{{TemplateID: "a"}, {TemplateID: "b"}}
+	zero, wide := 0, 40
+	for _, tt := range []struct {
+		name string
+		cmd  CreateMemeCommand
+		want int
+	}{
+		{"single template", CreateMemeCommand{TemplateID: "a"}, 0},
+		{"default", CreateMemeCommand{Composition: CompositionStrip, Panels: panels}, DefaultGutter},
+		{"zero", CreateMemeCommand{Composition: CompositionStrip, Panels: panels, Gutter: &zero}, 0},
+		{"wide", CreateMemeCommand{Composition: CompositionStrip, Panels: panels, Gutter: &wide}, 40},
+	} {
+		if got := tt.cmd.gutter(); got != tt.want {
+			t.Errorf("%s: gutter is %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// zero gutter composes panels edge to edge
+	m := &Meme{Composition: CompositionStrip, Panels: panels, Gutter: zero}
+	img := m.composePanels([]draw.Image{image.NewNRGBA(image.Rect(0, 0, 100, 50)), image.NewNRGBA(image.Rect(0, 0, 100, 50))})
+	if got := img.Bounds().Size(); got != image.Pt(200, 50) {
+		t.Errorf("meme with zero gutter is %v, want 200x50", got)
+	}
+}
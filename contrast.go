@@ -0,0 +1,93 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// contrastSamples is approximate number of pixels sampled under caption.
+	contrastSamples = 4096
+
+	// busyDeviation is deviation of luminance above which background is
+	// considered busy and outline is widened.
+	busyDeviation = 0.15
+)
+
+// autoContrast sets caption fill and outline colors contrasting with image
+// in rectangle under caption. Fill is the one of black and white with
+// higher WCAG contrast ratio to mean luminance, outline is the other one.
+func (r *Renderer) autoContrast(img image.Image, rect image.Rectangle, l *captionLayout) {
+	mean, deviation := luminanceStats(img, rect)
+
+	// contrast ratio of white is 1.05/(L+0.05) and of black (L+0.05)/0.05,
+	// they are equal at L = sqrt(1.05*0.05) - 0.05
+	if mean > math.Sqrt(1.05*0.05)-0.05 {
+		l.style.Color, l.style.OutlineColor = color.Black, color.White
+	} else {
+		l.style.Color, l.style.OutlineColor = color.White, color.Black
+	}
+
+	// one pixel per 24 pixels of font size keeps outline visible but thin
+	minWidth := 1
+	if deviation > busyDeviation {
+		minWidth = int(math.Ceil(l.size * r.opts.DPI / 72 / 24))
+	}
+
+	if l.style.OutlineWidth < minWidth {
+		l.style.OutlineWidth = minWidth
+	}
+}
+
+// luminanceStats returns mean and standard deviation of relative luminance
+// of pixels in rectangle, sampled in regular grid. Empty rectangle is
+// reported as black.
+func luminanceStats(img image.Image, rect image.Rectangle) (float64, float64) {
+	rect = rect.Intersect(img.Bounds())
+	if rect.Empty() {
+		return 0, 0
+	}
+
+	step := int(math.Sqrt(float64(rect.Dx()*rect.Dy()) / contrastSamples))
+	if step < 1 {
+		step = 1
+	}
+
+	var sum, sumSq float64
+	n := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y += step {
+		for x := rect.Min.X; x < rect.Max.X; x += step {
+			lum := relativeLuminance(img.At(x, y))
+			sum += lum
+			sumSq += lum * lum
+			n++
+		}
+	}
+
+	mean := sum / float64(n)
+	variance := sumSq/float64(n) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+
+	return mean, math.Sqrt(variance)
+}
+
+// relativeLuminance returns WCAG relative luminance of color, transparent
+// colors are treated as premultiplied over black.
+func relativeLuminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+
+	return 0.2126*linearize(r) + 0.7152*linearize(g) + 0.0722*linearize(b)
+}
+
+// linearize converts 16-bit sRGB channel value to linear light.
+func linearize(v uint32) float64 {
+	c := float64(v) / 0xffff
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
@@ -0,0 +1,57 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestAutoContrast(t *testing.T) {
+	r := testRenderer(t)
+
+	checkerboard := image.NewGray(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if (x/4+y/4)%2 == 0 {
+				checkerboard.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		name         string
+		img          image.Image
+		fill         color.Color
+		outlineWider bool
+	}{
+		{"sky", image.NewUniform(color.RGBA{R: 0xe0, G: 0xf0, B: 0xff, A: 0xff}), color.Black, false},
+		{"night", image.NewUniform(color.RGBA{R: 0x10, G: 0x10, B: 0x30, A: 0xff}), color.White, false},
+		{"busy", checkerboard, color.Black, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := image.NewNRGBA64(image.Rect(0, 0, 400, 200))
+			draw.Draw(dst, dst.Bounds(), tt.img, image.Point{}, draw.Src)
+
+			l := r.layoutCaption(Caption{Text: "AUTO CONTRAST", Style: TextStyle{AutoColor: true}}, 0, 400, func(m font.Metrics) fixed.Int26_6 {
+				return m.Ascent
+			})
+			r.autoContrast(dst, l.bounds(), l)
+
+			if l.style.Color != tt.fill {
+				t.Errorf("fill is %v, want %v", l.style.Color, tt.fill)
+			}
+
+			if l.style.OutlineColor == tt.fill {
+				t.Errorf("outline has the same color as fill")
+			}
+
+			if wider := l.style.OutlineWidth > 1; wider != tt.outlineWider {
+				t.Errorf("outline width is %d", l.style.OutlineWidth)
+			}
+		})
+	}
+}
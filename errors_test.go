@@ -0,0 +1,34 @@
+package memecreator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadMultipartForm(t *testing.T) {
+	malformed := httptest.NewRequest("POST", "/memes", strings.NewReader("not multipart"))
+	malformed.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+
+	for _, tt := range []struct {
+		name     string
+		r        *http.Request
+		maxSize  int64
+		tooLarge bool
+		err      bool
+	}{
+		{"valid", inlineMemeRequest(t, map[string]string{"top": "TOP"}), MaxTemplateSize, false, false},
+		{"malformed", malformed, MaxTemplateSize, false, true},
+		{"large", inlineMemeRequest(t, map[string]string{
+			"junk": strings.Repeat("x", MaxTemplateSize+maxFormFieldsSize),
+		}), MaxTemplateSize, true, true},
+		// template file is larger than limit, the whole body is not
+		{"large file", inlineMemeRequest(t, map[string]string{"top": "TOP"}), 64, true, true},
+	} {
+		tooLarge, err := readMultipartForm(httptest.NewRecorder(), tt.r, tt.maxSize)
+		if tooLarge != tt.tooLarge || (err != nil) != tt.err {
+			t.Errorf("%s request is too large %t with error %v, want %t and error %t", tt.name, tooLarge, err, tt.tooLarge, tt.err)
+		}
+	}
+}
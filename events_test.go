@@ -0,0 +1,108 @@
+package memecreator
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemeBrokerSubscribe(t *testing.T) {
+	b := NewMemeBroker()
+
+	all, cancelAll := b.Subscribe("")
+	defer cancelAll()
+	one, cancelOne := b.Subscribe("meme-1")
+
+	b.Publish(MemeEvent{MemeID: "meme-1", Status: MemeStatusRendering})
+	b.Publish(MemeEvent{MemeID: "meme-2", Status: MemeStatusRendering})
+
+	if len(all) != 2 {
+		t.Errorf("subscriber of all memes got %d events, want 2", len(all))
+	}
+
+	if e := <-one; e.MemeID != "meme-1" || len(one) != 0 {
+		t.Errorf("subscriber of meme-1 got %+v and %d more events, want only meme-1 event", e, len(one))
+	}
+
+	// cancel is idempotent and stops delivery
+	cancelOne()
+	cancelOne()
+	b.Publish(MemeEvent{MemeID: "meme-1", Status: MemeStatusDone})
+
+	if len(one) != 0 {
+		t.Errorf("canceled subscriber got %d events, want none", len(one))
+	}
+
+	if n := len(b.subs); n != 1 {
+		t.Errorf("broker has %d subscribers, want 1", n)
+	}
+}
+
+func TestMemeBrokerPublishNonBlocking(t *testing.T) {
+	b := NewMemeBroker()
+
+	events, cancel := b.Subscribe("meme-1")
+	defer cancel()
+
+	// nobody reads events, publishing past buffer size must not block
+	for i := 0; i < MemeEventsBufferSize+10; i++ {
+		b.Publish(MemeEvent{MemeID: "meme-1", Status: MemeStatusRendering})
+	}
+	b.Publish(MemeEvent{MemeID: "meme-1", Status: MemeStatusDone})
+
+	if len(events) != MemeEventsBufferSize {
+		t.Errorf("subscriber has %d buffered events, want %d", len(events), MemeEventsBufferSize)
+	}
+
+	// events over buffer size are dropped, buffered ones are kept
+	for len(events) > 0 {
+		if e := <-events; e.Status != MemeStatusRendering {
+			t.Errorf("buffered event is %s, want %s", e.Status, MemeStatusRendering)
+		}
+	}
+}
+
+func TestIsFinalMemeStatus(t *testing.T) {
+	for status, want := range map[string]bool{
+		MemeStatusQueued:    false,
+		MemeStatusRendering: false,
+		MemeStatusDone:      true,
+		MemeStatusFailed:    true,
+	} {
+		if got := isFinalMemeStatus(status); got != want {
+			t.Errorf("status %s is final %t, want %t", status, got, want)
+		}
+	}
+}
+
+func TestStreamMemeEventsPoll(t *testing.T) {
+	// worker on other instance publishes nothing to this broker
+	statuses := []string{MemeStatusQueued, MemeStatusRendering, MemeStatusRendering, MemeStatusDone}
+	poll := &memeStatusPoll{
+		interval: time.Millisecond,
+		status: func() (string, error) {
+			status := statuses[0]
+			statuses = statuses[1:]
+			return status, nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	streamMemeEvents(w, httptest.NewRequest("GET", "/memes/meme-1/events", nil), make(chan MemeEvent), &MemeEvent{
+		MemeID: "meme-1",
+		Status: MemeStatusQueued,
+	}, poll)
+
+	var got []string
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, "event: ") {
+			got = append(got, strings.TrimPrefix(line, "event: "))
+		}
+	}
+
+	want := []string{MemeStatusQueued, MemeStatusRendering, MemeStatusDone}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("stream has events %v, want %v", got, want)
+	}
+}
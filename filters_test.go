@@ -0,0 +1,164 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// testNRGBA returns copy of test template as 8-bit image.
+func testNRGBA(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), testTemplate(w, h), image.Point{}, draw.Src)
+	return img
+}
+
+func TestGrayscale(t *testing.T) {
+	img := Grayscale(1)(testNRGBA(32, 32))
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != img.Pix[i+1] || img.Pix[i+1] != img.Pix[i+2] {
+			t.Fatalf("pixel %v is not gray", img.Pix[i:i+4])
+		}
+	}
+}
+
+func TestPixelate(t *testing.T) {
+	img := Pixelate(8)(testNRGBA(32, 32))
+
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if img.At(x, y) != img.At(x/8*8, y/8*8) {
+				t.Fatalf("pixel %d,%d differs from its block", x, y)
+			}
+		}
+	}
+}
+
+func TestGaussianBlur(t *testing.T) {
+	uniform := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(uniform, uniform.Bounds(), image.NewUniform(color.NRGBA{10, 200, 30, 255}), image.Point{}, draw.Src)
+
+	if c := GaussianBlur(2)(uniform).NRGBAAt(8, 8); c != (color.NRGBA{10, 200, 30, 255}) {
+		t.Errorf("blurred uniform image changed to %v", c)
+	}
+
+	// sharp edge between black and white halves becomes gradient
+	edge := image.NewNRGBA(image.Rect(0, 0, 16, 1))
+	for x := 8; x < 16; x++ {
+		edge.SetNRGBA(x, 0, color.NRGBA{255, 255, 255, 255})
+	}
+	edge = GaussianBlur(2)(edge)
+
+	if left, right := edge.NRGBAAt(7, 0).R, edge.NRGBAAt(8, 0).R; left == 0 || right == 255 || left >= right {
+		t.Errorf("edge is not smoothed, left %d right %d", left, right)
+	}
+}
+
+func TestGaussianBlurLargeSigma(t *testing.T) {
+	uniform := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(uniform, uniform.Bounds(), image.NewUniform(color.NRGBA{10, 200, 30, 255}), image.Point{}, draw.Src)
+
+	blurred := GaussianBlur(50)(uniform)
+	if blurred.Bounds() != uniform.Bounds() {
+		t.Errorf("blurred image bounds are %v, want %v", blurred.Bounds(), uniform.Bounds())
+	}
+	if c := blurred.NRGBAAt(100, 50); c != (color.NRGBA{10, 200, 30, 255}) {
+		t.Errorf("blurred uniform image changed to %v", c)
+	}
+
+	// edge is smoothed over distance comparable to sigma
+	edge := image.NewNRGBA(image.Rect(0, 0, 400, 1))
+	for x := 200; x < 400; x++ {
+		edge.SetNRGBA(x, 0, color.NRGBA{255, 255, 255, 255})
+	}
+	edge = GaussianBlur(50)(edge)
+
+	if near, far := edge.NRGBAAt(180, 0).R, edge.NRGBAAt(100, 0).R; near <= far || near == 0 || near >= 128 {
+		t.Errorf("edge is not smoothed over sigma, near %d far %d", near, far)
+	}
+}
+
+func TestNoiseIsDeterministic(t *testing.T) {
+	a := Noise(0.2, 7)(testNRGBA(16, 16))
+	b := Noise(0.2, 7)(testNRGBA(16, 16))
+
+	for i := range a.Pix {
+		if a.Pix[i] != b.Pix[i] {
+			t.Fatalf("noise with the same seed differs at %d", i)
+		}
+	}
+}
+
+func TestDeepFry(t *testing.T) {
+	src := testNRGBA(64, 64)
+	fried := DeepFry(1, 0)(testNRGBA(64, 64))
+
+	if !fried.Bounds().Eq(src.Bounds()) {
+		t.Fatalf("fried image has bounds %v, want %v", fried.Bounds(), src.Bounds())
+	}
+
+	// oversaturated image has more fully saturated channels
+	extremes := func(img *image.NRGBA) int {
+		n := 0
+		for i, v := range img.Pix {
+			if i%4 != 3 && (v == 0 || v == 255) {
+				n++
+			}
+		}
+		return n
+	}
+
+	if extremes(fried) <= extremes(src) {
+		t.Errorf("fried image is not oversaturated")
+	}
+}
+
+func TestValidateEffects(t *testing.T) {
+	for _, tt := range []struct {
+		effects []EffectSpec
+		errs    int
+	}{
+		{nil, 0},
+		{[]EffectSpec{{Name: "deep_fried"}, {Name: "blur", Stage: EffectStageBefore, Amount: 4}}, 0},
+		{[]EffectSpec{{Name: "sharpen"}}, 1},
+		{[]EffectSpec{{Name: "grayscale", Stage: "during"}}, 1},
+		{[]EffectSpec{{Name: "pixelate", Amount: 1000}}, 1},
+		{make([]EffectSpec, MaxEffects+1), MaxEffects + 2},
+	} {
+		if errs := validateEffects(tt.effects); len(errs) != tt.errs {
+			t.Errorf("effects %+v have %d errors, want %d", tt.effects, len(errs), tt.errs)
+		}
+	}
+}
+
+func TestRenderEffectsStages(t *testing.T) {
+	r := testRenderer(t, renderEffects([]EffectSpec{
+		{Name: "grayscale", Stage: EffectStageBefore},
+	}))
+
+	img, err := r.RenderCaptions(testTemplate(200, 100), Caption{
+		Text:  "RED",
+		Style: TextStyle{Color: color.NRGBA{R: 255, A: 255}},
+	}, Caption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// template is gray, caption drawn after effect keeps its color
+	hasRed := false
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.R == 255 && c.G == 0 && c.B == 0 {
+				hasRed = true
+			}
+		}
+	}
+
+	if !hasRed {
+		t.Errorf("caption drawn after grayscale effect is not red")
+	}
+}
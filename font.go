@@ -0,0 +1,420 @@
+package memecreator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/golang/freetype/truetype"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/file"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/user"
+)
+
+const (
+	// MaxFontSize is 10MB
+	MaxFontSize = 10 * 1024 * 1024
+
+	// FontKind is the name of kind in Datastore.
+	FontKind = "Font"
+
+	// FontObjectPrefix is prefix of cloud storage objects with uploaded fonts.
+	FontObjectPrefix = "fonts/"
+
+	// missingFontTTL is how long fallback fonts which failed to load are not
+	// looked up again.
+	missingFontTTL = 5 * time.Minute
+
+	// fontCheckInterval is how often uploaded fonts registered on instance
+	// are checked for newer upload with the same id.
+	fontCheckInterval = time.Minute
+)
+
+// FallbackFontIDs are ids of fonts tried in order for runes missing in meme
+// font. Uploading fonts with these ids (e.g. Noto families) extends scripts
+// and symbols memes can use, missing ones are skipped.
+var FallbackFontIDs = []string{
+	"noto-sans",
+	"noto-sans-arabic",
+	"noto-sans-hebrew",
+	"noto-sans-cjk",
+	"noto-emoji",
+	"go-regular",
+}
+
+// fontIDPattern matches ids allowed for uploaded fonts.
+var fontIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// Font is type used for storing details about uploaded font.
+type Font struct {
+	Created  time.Time `json:"created"`
+	Name     string    `json:"name"`
+	Filename string    `json:"filename"`
+}
+
+// FontResponse is type returned as response from API.
+type FontResponse struct {
+	ID      string `json:"id"`
+	Builtin bool   `json:"builtin"`
+	Font
+}
+
+// FontsHandler handles actions getting fonts or uploading new font.
+func FontsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		GetFontsHandler(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	PostFontsHandler(w, r)
+}
+
+// GetFontsHandler handles getting builtin and uploaded fonts.
+func GetFontsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	var uploaded []*FontResponse
+	keys, err := datastore.NewQuery(FontKind).
+		Order("-Created").
+		GetAll(ctx, &uploaded)
+	if err != nil {
+		log.Errorf(ctx, "fetching fonts from datastore failed, error %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	fonts := make([]*FontResponse, 0, len(builtinFonts)+len(uploaded))
+	for _, id := range Fonts.IDs() {
+		if !isBuiltinFont(id) {
+			continue
+		}
+
+		f, _ := Fonts.Font(id)
+		fonts = append(fonts, &FontResponse{
+			ID:      id,
+			Builtin: true,
+			Font: Font{
+				Name: f.Name(truetype.NameIDFontFullName),
+			},
+		})
+	}
+
+	for i, f := range uploaded {
+		f.ID = keys[i].StringID()
+		fonts = append(fonts, f)
+	}
+
+	resp := map[string]interface{}{
+		"fonts": fonts,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf(ctx, "encoding fonts failed, error %s", err)
+		writeInternalError(w, r)
+		return
+	}
+}
+
+// PostFontsHandler handles uploading new TrueType font, only admins can
+// upload fonts. Fonts must have TrueType (glyf) outlines, OpenType fonts with
+// CFF outlines are rejected because renderer can't draw them.
+func PostFontsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	if !user.IsAdmin(ctx) {
+		writeError(w, r, http.StatusForbidden, ErrorCodeForbidden, "only admins can upload fonts")
+		return
+	}
+
+	if !parseMultipartForm(ctx, w, r, MaxFontSize, ErrorCodeFontTooLarge, "font is too large") {
+		return
+	}
+
+	fontFile, fontHandler, err := r.FormFile("font")
+	if err != nil {
+		log.Errorf(ctx, "getting multipart form font object failed, error: %s", err)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeMissingFontFile, "missing font file in request")
+		return
+	}
+	defer fontFile.Close()
+
+	fontBytes, err := ioutil.ReadAll(fontFile)
+	if err != nil {
+		log.Errorf(ctx, "reading font file failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	fontID := r.FormValue("id")
+
+	var validationErrs []*ValidationError
+	if !fontIDPattern.MatchString(fontID) {
+		validationErrs = append(validationErrs, &ValidationError{
+			Field:   "id",
+			Message: "font id must be lowercase letters, digits and dashes",
+		})
+	} else if isBuiltinFont(fontID) {
+		validationErrs = append(validationErrs, &ValidationError{
+			Field:   "id",
+			Message: "font id is used by builtin font",
+		})
+	}
+
+	f, fontErr := parseUploadedFont(fontBytes)
+	if fontErr != nil {
+		validationErrs = append(validationErrs, fontErr)
+	}
+
+	if len(validationErrs) > 0 {
+		writeAPIError(w, r, &APIError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidationFailed,
+			Message: "font is invalid",
+			Details: validationErrs,
+		})
+		return
+	}
+
+	storageClient, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Errorf(ctx, "getting storage client failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	bucketName, err := file.DefaultBucketName(ctx)
+	if err != nil {
+		log.Errorf(ctx, "getting storage bucket name failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	filename := FontObjectPrefix + fontID
+	csow := storageClient.
+		Bucket(bucketName).
+		Object(filename).
+		NewWriter(ctx)
+	if _, err := csow.Write(fontBytes); err != nil {
+		log.Errorf(ctx, "copying font to cloud storage failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	if err := csow.Close(); err != nil {
+		log.Errorf(ctx, "closing cloud storage writer failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	name := f.Name(truetype.NameIDFontFullName)
+	if name == "" {
+		name = fontHandler.Filename
+	}
+
+	// datastore keeps times in microseconds, registered version must match
+	// the stored one
+	font := Font{
+		Created:  time.Now().Truncate(time.Microsecond),
+		Name:     name,
+		Filename: filename,
+	}
+	if _, err := datastore.Put(
+		ctx,
+		datastore.NewKey(ctx, FontKind, fontID, 0, nil),
+		&font,
+	); err != nil {
+		log.Errorf(ctx, "storing font in datastore failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	if _, err := Fonts.RegisterVersion(fontID, fontBytes, font.Created); err != nil {
+		log.Errorf(ctx, "registering font failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"font": &FontResponse{
+			ID:   fontID,
+			Font: font,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf(ctx, "encoding font failed, error %s", err)
+		return
+	}
+}
+
+// cffFontTag is sfnt version of OpenType fonts with CFF outlines.
+const cffFontTag = "OTTO"
+
+// parseUploadedFont parses uploaded font file, fonts which aren't TrueType
+// fonts are reported as validation error of font field.
+func parseUploadedFont(fontBytes []byte) (*truetype.Font, *ValidationError) {
+	if bytes.HasPrefix(fontBytes, []byte(cffFontTag)) {
+		return nil, &ValidationError{
+			Field:   "font",
+			Message: "only TrueType outlines are supported, OpenType font with CFF outlines can't be used",
+		}
+	}
+
+	f, err := truetype.Parse(fontBytes)
+	if err != nil {
+		return nil, &ValidationError{
+			Field:   "font",
+			Message: "font is not supported TrueType font",
+		}
+	}
+
+	return f, nil
+}
+
+// loadFont returns font with given id from registry, uploaded fonts missing
+// in registry of this instance are loaded from cloud storage and registered.
+// Registered uploaded fonts are compared with datastore once per
+// fontCheckInterval and reloaded when font was uploaded again.
+func loadFont(ctx context.Context, fontID string) (*truetype.Font, error) {
+	if fontID == "" {
+		fontID = DefaultFontID
+	}
+
+	f, registered := Fonts.Font(fontID)
+	if registered && (isBuiltinFont(fontID) || checkedFonts.has(fontID, time.Now())) {
+		return f, nil
+	}
+
+	var font Font
+	if err := datastore.Get(
+		ctx,
+		datastore.NewKey(ctx, FontKind, fontID, 0, nil),
+		&font,
+	); err != nil {
+		if registered {
+			log.Warningf(ctx, "checking font %s in datastore failed, error: %s", fontID, err)
+			return f, nil
+		}
+		return nil, fmt.Errorf("getting font %s from datastore failed, error: %s", fontID, err)
+	}
+
+	if version, _ := Fonts.Version(fontID); registered && version.Equal(font.Created) {
+		checkedFonts.add(fontID, time.Now())
+		return f, nil
+	}
+
+	storageClient, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage client failed, error: %s", err)
+	}
+
+	bucketName, err := file.DefaultBucketName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage bucket name failed, error: %s", err)
+	}
+
+	fontReader, err := storageClient.
+		Bucket(bucketName).
+		Object(font.Filename).
+		NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage object failed, error: %s", err)
+	}
+	defer fontReader.Close()
+
+	fontBytes, err := ioutil.ReadAll(fontReader)
+	if err != nil {
+		return nil, fmt.Errorf("reading storage object failed, error: %s", err)
+	}
+
+	f, err = Fonts.RegisterVersion(fontID, fontBytes, font.Created)
+	if err != nil {
+		return nil, err
+	}
+	checkedFonts.add(fontID, time.Now())
+
+	return f, nil
+}
+
+// fallbackFonts returns meme font followed by all available fallback fonts.
+// Fonts which failed to load are skipped without lookup for missingFontTTL.
+func fallbackFonts(ctx context.Context, memeFont *truetype.Font) FontSet {
+	fonts := FontSet{memeFont}
+	for _, fontID := range FallbackFontIDs {
+		if _, ok := Fonts.Font(fontID); !ok && missingFonts.has(fontID, time.Now()) {
+			continue
+		}
+
+		f, err := loadFont(ctx, fontID)
+		if err != nil {
+			log.Debugf(ctx, "skipping fallback font %s, error: %s", fontID, err)
+			missingFonts.add(fontID, time.Now())
+			continue
+		}
+
+		if f != memeFont {
+			fonts = append(fonts, f)
+		}
+	}
+
+	return fonts
+}
+
+// missingFonts are fallback fonts which failed to load on this instance.
+var missingFonts = newFontMisses(missingFontTTL)
+
+// checkedFonts are uploaded fonts recently checked to match datastore.
+var checkedFonts = newFontMisses(fontCheckInterval)
+
+// fontMisses remembers font ids until ttl passes.
+type fontMisses struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	until map[string]time.Time
+}
+
+// newFontMisses creates empty misses expiring after ttl.
+func newFontMisses(ttl time.Duration) *fontMisses {
+	return &fontMisses{
+		ttl:   ttl,
+		until: make(map[string]time.Time),
+	}
+}
+
+// add records that font failed to load at given time.
+func (m *fontMisses) add(id string, now time.Time) {
+	m.mu.Lock()
+	m.until[id] = now.Add(m.ttl)
+	m.mu.Unlock()
+}
+
+// has reports whether font failed to load less than ttl before given time.
+func (m *fontMisses) has(id string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	until, ok := m.until[id]
+	if ok && !now.Before(until) {
+		delete(m.until, id)
+		return false
+	}
+
+	return ok
+}
@@ -0,0 +1,120 @@
+package memecreator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestParseFontCached(t *testing.T) {
+	// both fonts are parsed from the same reused buffer
+	size := len(goregular.TTF)
+	if len(gobold.TTF) > size {
+		size = len(gobold.TTF)
+	}
+	buf := make([]byte, size)
+
+	copy(buf, goregular.TTF)
+	regular, err := parseFontCached(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copy(buf, make([]byte, size))
+	copy(buf, gobold.TTF)
+	bold, err := parseFontCached(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bold.Name(truetype.NameIDFontFullName); got != "Go Bold" {
+		t.Errorf("font parsed from reused buffer is %q, want Go Bold", got)
+	}
+
+	copy(buf, make([]byte, size))
+	copy(buf, goregular.TTF)
+	if f, _ := parseFontCached(append([]byte(nil), buf...)); f != regular {
+		t.Errorf("font parsed from copy of bytes is %q, want cached %q", f.Name(truetype.NameIDFontFullName), regular.Name(truetype.NameIDFontFullName))
+	}
+}
+
+func TestAcquireFaceEvictsLeastRecentlyUsed(t *testing.T) {
+	f, err := parseFontCached(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquire := func(size float64) {
+		_, release := acquireFace(f, size, 72, font.HintingNone)
+		release()
+	}
+	cached := func(size float64) bool {
+		faceCache.Lock()
+		defer faceCache.Unlock()
+		_, ok := faceCache.pools[faceKey{font: f, size: size, dpi: 72, hinting: font.HintingNone}]
+		return ok
+	}
+
+	acquire(1)
+	acquire(2)
+	for i := 0; i < maxFacePools; i++ {
+		acquire(1)
+		acquire(3 + float64(i)/100)
+	}
+
+	if !cached(1) {
+		t.Errorf("recently used face settings are evicted")
+	}
+	if cached(2) {
+		t.Errorf("least recently used face settings are not evicted")
+	}
+	if n := len(faceCache.pools); n > maxFacePools {
+		t.Errorf("face cache size is %d, want at most %d", n, maxFacePools)
+	}
+}
+
+func TestMeasureDoesNotPoolFaces(t *testing.T) {
+	r := testRenderer(t)
+	runs := r.textRuns("ONE DOES NOT SIMPLY WALK INTO MORDOR", nil)
+
+	faceCache.Lock()
+	before := len(faceCache.pools)
+	faceCache.Unlock()
+
+	r.fitFontSize(runs, 100, 0)
+
+	faceCache.Lock()
+	after := len(faceCache.pools)
+	faceCache.Unlock()
+
+	if after != before {
+		t.Errorf("fitting font size pooled %d faces, want 0", after-before)
+	}
+}
+
+func TestFontRegistryVersion(t *testing.T) {
+	fr := NewFontRegistry()
+	uploaded := time.Date(2017, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, ok := fr.Version("noto-sans"); ok {
+		t.Errorf("version of unregistered font is found")
+	}
+
+	fr.Register("go-regular", goregular.TTF)
+	if v, ok := fr.Version("go-regular"); !ok || !v.IsZero() {
+		t.Errorf("version of builtin font is %v, want zero", v)
+	}
+
+	old, _ := fr.RegisterVersion("noto-sans", goregular.TTF, uploaded)
+	f, _ := fr.RegisterVersion("noto-sans", gobold.TTF, uploaded.Add(time.Hour))
+	if v, _ := fr.Version("noto-sans"); !v.Equal(uploaded.Add(time.Hour)) {
+		t.Errorf("version of reuploaded font is %v, want %v", v, uploaded.Add(time.Hour))
+	}
+	if got, _ := fr.Font("noto-sans"); got != f || got == old {
+		t.Errorf("registry returns stale font after reupload")
+	}
+}
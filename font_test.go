@@ -0,0 +1,53 @@
+package memecreator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestFontMisses(t *testing.T) {
+	misses := newFontMisses(time.Minute)
+	now := time.Now()
+
+	misses.add("noto-sans", now)
+
+	for _, tt := range []struct {
+		id   string
+		at   time.Time
+		want bool
+	}{
+		{"noto-sans", now, true},
+		{"noto-sans", now.Add(59 * time.Second), true},
+		{"noto-emoji", now, false},
+		{"noto-sans", now.Add(time.Minute), false},
+		// expired miss is forgotten
+		{"noto-sans", now, false},
+	} {
+		if got := misses.has(tt.id, tt.at); got != tt.want {
+			t.Errorf("miss of %s at %v is %t, want %t", tt.id, tt.at.Sub(now), got, tt.want)
+		}
+	}
+}
+
+func TestParseUploadedFont(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    []byte
+		message string
+	}{
+		{"truetype", goregular.TTF, ""},
+		{"cff", append([]byte(cffFontTag), goregular.TTF[4:]...), "CFF outlines"},
+		{"garbage", []byte("not a font"), "not supported"},
+	} {
+		f, err := parseUploadedFont(tt.data)
+		switch {
+		case tt.message == "" && (err != nil || f == nil):
+			t.Errorf("%s font has error %+v, want parsed font", tt.name, err)
+		case tt.message != "" && (err == nil || err.Field != "font" || !strings.Contains(err.Message, tt.message)):
+			t.Errorf("%s font has error %+v, want font error about %s", tt.name, err, tt.message)
+		}
+	}
+}
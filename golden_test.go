@@ -0,0 +1,204 @@
+package memecreator
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden images in testdata")
+
+const (
+	// goldenThreshold is perceptual color distance from 0 to 1 above which
+	// pixel differs from golden, smaller differences are not visible.
+	goldenThreshold = 0.1
+
+	// goldenTolerance is fraction of pixels which may differ from golden,
+	// it covers antialiasing changes of rasterizer, not moved text.
+	goldenTolerance = 0.002
+)
+
+// goldenCaptions are caption cases rendered on every fixture template.
+var goldenCaptions = []struct {
+	name   string
+	top    string
+	bottom string
+}{
+	{"long", "WHEN THE CAPTION IS SO LONG IT HAS TO SHRINK", "AND THE BOTTOM ONE KEEPS GOING ON AND ON"},
+	{"unicode", "ŽLUŤOUČKÝ KŮŇ ÚPĚL", "ΓΕΙΑ ΣΟΥ · ПРИВЕТ"},
+	{"empty-top", "", "ONLY BOTTOM"},
+	{"empty-bottom", "ONLY TOP", ""},
+}
+
+// TestRenderMemeGolden renders caption cases on every fixture template in
+// testdata/templates with RenderMeme and compares them with goldens.
+func TestRenderMemeGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "templates", "*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixture templates in testdata/templates")
+	}
+
+	for _, fixture := range fixtures {
+		src := loadPNG(t, fixture)
+		name := strings.TrimSuffix(filepath.Base(fixture), ".png")
+
+		for _, c := range goldenCaptions {
+			t.Run(name+"/"+c.name, func(t *testing.T) {
+				img, err := RenderMeme(WorkerFontBytes, src, c.top, c.bottom)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				checkGolden(t, filepath.Join("testdata", "golden", "templates", name+"-"+c.name+".png"), img)
+			})
+		}
+	}
+}
+
+func TestPerceptualDiff(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	b := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for i := range a.Pix {
+		a.Pix[i], b.Pix[i] = 200, 200
+	}
+
+	// barely visible change is ignored, clearly different pixel is not
+	b.SetNRGBA(1, 1, color.NRGBA{202, 200, 199, 200})
+	b.SetNRGBA(5, 5, color.NRGBA{0, 0, 0, 255})
+
+	n, diff := perceptualDiff(a, b, goldenThreshold)
+	if n != 1 {
+		t.Errorf("%d pixels differ, want 1", n)
+	}
+
+	if c := diff.NRGBAAt(5, 5); c.R != 255 || c.G != 0 {
+		t.Errorf("differing pixel is %v in diff image, want red", c)
+	}
+}
+
+// loadPNG decodes PNG file.
+func loadPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decoding %s failed, error: %s", path, err)
+	}
+
+	return img
+}
+
+// savePNG encodes image to PNG file, creating its directory.
+func savePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkGolden compares image with golden image stored in path, with -update
+// flag golden image is overwritten instead. Images match when at most
+// goldenTolerance of pixels differ perceptually, otherwise rendered image
+// and diff are written to temporary directory for inspection.
+func checkGolden(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	if *update {
+		savePNG(t, path, img)
+		return
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("opening golden image failed, run with -update to create it, error: %s", err)
+	}
+	golden := loadPNG(t, path)
+
+	if !golden.Bounds().Eq(img.Bounds()) {
+		t.Fatalf("image bounds %v differ from golden %v", img.Bounds(), golden.Bounds())
+	}
+
+	n, diff := perceptualDiff(golden, img, goldenThreshold)
+	total := img.Bounds().Dx() * img.Bounds().Dy()
+	if float64(n) <= goldenTolerance*float64(total) {
+		return
+	}
+
+	out := filepath.Join(os.TempDir(), "memecreator-golden", strings.Replace(filepath.ToSlash(path), "/", "_", -1))
+	savePNG(t, strings.TrimSuffix(out, ".png")+"-got.png", img)
+	savePNG(t, strings.TrimSuffix(out, ".png")+"-diff.png", diff)
+
+	t.Fatalf("%d of %d pixels differ from golden image %s, rendered image and diff are in %s",
+		n, total, path, filepath.Dir(out))
+}
+
+// perceptualDiff returns number of pixels whose colors differ by more than
+// threshold and image with differing pixels in red over faded golden.
+// Distance is computed in YIQ color space after blending over white, which
+// weights brightness changes above hue changes like human eye.
+func perceptualDiff(golden, img image.Image, threshold float64) (int, *image.NRGBA) {
+	// maximum YIQ distance, between black and white
+	const maxDelta = 35215.0
+
+	bounds := golden.Bounds()
+	diff := image.NewNRGBA(bounds)
+
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			y1, i1, q1 := yiq(golden.At(x, y))
+			y2, i2, q2 := yiq(img.At(x, y))
+			dy, di, dq := y1-y2, i1-i2, q1-q2
+			delta := 0.5053*dy*dy + 0.299*di*di + 0.1957*dq*dq
+
+			if delta > threshold*threshold*maxDelta {
+				diff.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+				n++
+				continue
+			}
+
+			faded := uint8(255 - (255-y1)*0.1)
+			diff.SetNRGBA(x, y, color.NRGBA{R: faded, G: faded, B: faded, A: 255})
+		}
+	}
+
+	return n, diff
+}
+
+// yiq returns YIQ components of color blended over white, in 0 to 255 range
+// of luma.
+func yiq(c color.Color) (float64, float64, float64) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	a := float64(n.A) / 255
+	r := 255 + (float64(n.R)-255)*a
+	g := 255 + (float64(n.G)-255)*a
+	b := 255 + (float64(n.B)-255)*a
+
+	return 0.29889531*r + 0.58662247*g + 0.11448223*b,
+		0.59597799*r - 0.27417610*g - 0.32180189*b,
+		0.21147017*r - 0.52261711*g + 0.31114694*b
+}
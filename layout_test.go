@@ -0,0 +1,234 @@
+package memecreator
+
+import (
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/language"
+)
+
+// testRenderer creates renderer with default font.
+func testRenderer(t testing.TB, opts ...RenderOption) *Renderer {
+	f, _ := Fonts.Font(DefaultFontID)
+
+	r, err := NewRenderer(append([]RenderOption{WithFonts(f)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestFitFontSize(t *testing.T) {
+	r := testRenderer(t)
+
+	for _, tt := range []struct {
+		text  string
+		width int
+	}{
+		{"ONE DOES NOT SIMPLY", 600},
+		{"ONE DOES NOT SIMPLY", 300},
+		{"AVAVAVAV WAVE TO KERNING", 400},
+		{"iiiiiiiiiiiiiiiiiiiiiiiiiiiiii", 200},
+		{"WWWWWWWWWWWWWWWWWWWWWWWWWWWWWW", 800},
+	} {
+		runs := r.textRuns(tt.text, nil)
+		size, textWidth := r.fitFontSize(runs, tt.width, 0)
+
+		if size < r.opts.MinFontSize || size > r.opts.MaxFontSize {
+			t.Errorf("%q in %d: size %v out of range", tt.text, tt.width, size)
+		}
+
+		if textWidth != r.measureRuns(runs, size, 0) {
+			t.Errorf("%q in %d: returned width %v doesn't match measured width", tt.text, tt.width, textWidth)
+		}
+
+		if textWidth > fixed.I(tt.width) {
+			t.Errorf("%q in %d: width %v overflows at size %v", tt.text, tt.width, textWidth, size)
+		}
+
+		// fitted size is the largest one, one step bigger doesn't fit
+		if size < r.opts.MaxFontSize {
+			if bigger := r.measureRuns(runs, size+fontSizeStep, 0); bigger <= fixed.I(tt.width) {
+				t.Errorf("%q in %d: size %v is not the largest fitting size", tt.text, tt.width, size)
+			}
+		}
+	}
+}
+
+func TestFitFontSizeShortText(t *testing.T) {
+	r := testRenderer(t)
+
+	size, _ := r.fitFontSize(r.textRuns("HI", nil), 1000, 0)
+	if size != r.opts.MaxFontSize {
+		t.Errorf("size is %v, want maximum %v", size, r.opts.MaxFontSize)
+	}
+}
+
+func TestFitFontSizeOverflow(t *testing.T) {
+	r := testRenderer(t)
+
+	size, _ := r.fitFontSize(r.textRuns("THIS CAPTION IS WAY TOO LONG FOR SUCH A TINY TEMPLATE", nil), 50, 0)
+	if size != r.opts.MinFontSize {
+		t.Errorf("size is %v, want minimum %v", size, r.opts.MinFontSize)
+	}
+}
+
+func TestMeasureRunsScalesWithSize(t *testing.T) {
+	r := testRenderer(t)
+
+	runs := r.textRuns("SCALING TEXT", nil)
+	small, large := r.measureRuns(runs, 24, 0), r.measureRuns(runs, 48, 0)
+
+	// without hinting advances scale linearly, allow rounding of each glyph
+	if diff := large - 2*small; diff < -fixed.I(1) || diff > fixed.I(1) {
+		t.Errorf("width at 48pt is %v, want twice width at 24pt %v", large, small)
+	}
+}
+
+func TestLayoutCaptionCentered(t *testing.T) {
+	r := testRenderer(t)
+
+	for _, width := range []int{300, 500} {
+		l := r.layoutCaption(Caption{Text: "CENTER ME"}, 20, width, func(m font.Metrics) fixed.Int26_6 {
+			return m.Ascent
+		})
+
+		leftSpace := l.dot.X - fixed.I(20)
+		rightSpace := fixed.I(20+width) - (l.dot.X + l.width)
+		if diff := leftSpace - rightSpace; diff < -1 || diff > 1 {
+			t.Errorf("caption in %d is off center, left %v right %v", width, leftSpace, rightSpace)
+		}
+	}
+}
+
+func TestMeasureRunsLetterSpacing(t *testing.T) {
+	r := testRenderer(t)
+
+	runs := r.textRuns("SPACE", nil)
+	plain, spaced := r.measureRuns(runs, 40, 0), r.measureRuns(runs, 40, 0.1)
+
+	// four gaps between five letters, each 0.1em of 40px
+	if want := plain + fixed.I(16); spaced != want {
+		t.Errorf("spaced width is %v, want %v", spaced, want)
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	r := testRenderer(t)
+
+	text := "modern memes put the caption on a white band above the picture"
+	lines := r.wrapLines(text, 32, 0, 300, nil)
+	if len(lines) < 2 {
+		t.Fatalf("text is wrapped into %d lines, want more", len(lines))
+	}
+
+	if joined := strings.Join(lines, " "); joined != text {
+		t.Errorf("wrapped lines are %q, want all words of %q", joined, text)
+	}
+
+	for _, line := range lines {
+		if w := r.measureRuns(r.textRuns(line, nil), 32, 0); w > fixed.I(300) {
+			t.Errorf("line %q is %v wide, overflows 300", line, w)
+		}
+	}
+}
+
+func TestRenderBandsGrowsCanvas(t *testing.T) {
+	r := testRenderer(t, WithLayout(LayoutBands))
+
+	img, err := r.Render(testTemplate(320, 240), "TOP TEXT", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() != 320 || bounds.Dy() <= 240 {
+		t.Errorf("image size is %v, want 320 wide and taller than 240", bounds.Size())
+	}
+
+	// template is moved below top band, nothing is added below it
+	if got, want := img.At(0, bounds.Dy()-1), testTemplate(320, 240).At(0, 239); !sameColor(got, want) {
+		t.Errorf("bottom left pixel is %v, want template pixel %v", got, want)
+	}
+}
+
+// sameColor reports whether colors are equal after conversion to RGBA.
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+func TestTransformText(t *testing.T) {
+	for _, tt := range []struct {
+		text      string
+		transform TextTransform
+		lang      language.Tag
+		want      string
+	}{
+		{"one does not simply", TransformNone, language.Und, "one does not simply"},
+		{"one does not simply", TransformUppercase, language.Und, "ONE DOES NOT SIMPLY"},
+		{"one does not simply", TransformTitle, language.Und, "One Does Not Simply"},
+		{"istanbul", TransformUppercase, language.Und, "ISTANBUL"},
+		{"istanbul", TransformUppercase, language.Turkish, "İSTANBUL"},
+		{"straße", TransformUppercase, language.German, "STRASSE"},
+	} {
+		if got, _ := transformText(tt.text, tt.transform, tt.lang); got != tt.want {
+			t.Errorf("transforming %q with %v in %v is %q, want %q", tt.text, tt.transform, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestTextRunsSmallCaps(t *testing.T) {
+	r := testRenderer(t)
+
+	_, caser := transformText("Hello", TransformSmallCaps, language.Und)
+	runs := r.textRuns("Hello", caser)
+
+	if len(runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(runs))
+	}
+
+	if runs[0].text != "H" || runs[0].small {
+		t.Errorf("first run is %q small %v, want full size H", runs[0].text, runs[0].small)
+	}
+
+	if runs[1].text != "ELLO" || !runs[1].small {
+		t.Errorf("second run is %q small %v, want small ELLO", runs[1].text, runs[1].small)
+	}
+}
+
+func TestRenderGolden(t *testing.T) {
+	src := testTemplate(320, 240)
+
+	for _, tt := range []struct {
+		name   string
+		top    string
+		bottom string
+		opts   []RenderOption
+	}{
+		{"short", "HI", "THERE", nil},
+		{"long", "ONE DOES NOT SIMPLY WALK INTO MORDOR", "WITHOUT MEASURING TEXT WIDTH", nil},
+		{"kerning", "AVATAR WAVY TYPO", "Yo, LAVA", nil},
+		{"bands", "when the caption is too long to fit over the picture it gets its own band", "", []RenderOption{
+			WithLayout(LayoutBands),
+			WithTextStyle(TextStyle{AutoColor: true}),
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRenderer(t, tt.opts...)
+
+			img, err := r.Render(src, tt.top, tt.bottom)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkGolden(t, filepath.Join("testdata", "golden", tt.name+".png"), img)
+		})
+	}
+}
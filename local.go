@@ -0,0 +1,201 @@
+package memecreator
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// RenderJob is meme rendered from local files without App Engine, e.g. by
+// command line tool. It has the same fields as API request, but template,
+// template ids of panels and sticker ids of overlays are file paths and font
+// id is id of builtin font or path to TrueType file.
+type RenderJob struct {
+	Template string `json:"template"`
+	Out      string `json:"out"`
+	CreateMemeCommand
+}
+
+// RenderJobFromForm creates job from form values with the same field names
+// as in create meme form, plus template and out file paths.
+func RenderJobFromForm(form url.Values) (*RenderJob, error) {
+	cmd, err := createMemeCommandFromForm(form)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RenderJob{
+		Template:          form.Get("template"),
+		Out:               form.Get("out"),
+		CreateMemeCommand: *cmd,
+	}, nil
+}
+
+// Validate checks job with the same validators as API, template, stickers
+// and fonts are files whose existence is checked when job is rendered.
+func (j *RenderJob) Validate() []*ValidationError {
+	cmd := &j.CreateMemeCommand
+
+	errs := validateMemeFields(cmd)
+	errs = append(errs, validateOverlayPlacement(cmd.Overlays)...)
+
+	for i, o := range cmd.Overlays {
+		if o.StickerID == "" {
+			errs = append(errs, &ValidationError{
+				Field:   fmt.Sprintf("overlays[%d].sticker_id", i),
+				Message: "sticker file is required",
+			})
+		}
+	}
+
+	if cmd.TemplateID != "" {
+		errs = append(errs, &ValidationError{
+			Field:   "template_id",
+			Message: "template id can't be used locally, use template file",
+		})
+	}
+
+	// composed memes have template files in panels
+	composed := len(cmd.Panels) > 0 || cmd.Composition != ""
+	if composed && j.Template != "" {
+		errs = append(errs, &ValidationError{
+			Field:   "template",
+			Message: "template file can't be combined with panels",
+		})
+	}
+
+	if !composed && j.Template == "" {
+		errs = append(errs, &ValidationError{
+			Field:   "template",
+			Message: "template file is required",
+		})
+	}
+
+	return errs
+}
+
+// Render renders meme of job and writes it in its output format. Template
+// and sticker images are loaded by load, font files are read directly.
+func (j *RenderJob) Render(w io.Writer, load func(path string) (image.Image, error)) error {
+	meme := j.meme()
+
+	memeFont, err := localFont(meme.FontID)
+	if err != nil {
+		return err
+	}
+
+	overlays, err := loadOverlays(meme.Overlays, load)
+	if err != nil {
+		return err
+	}
+
+	renderer, err := NewRenderer(append(
+		meme.renderOptions(),
+		WithFonts(registeredFallbackFonts(memeFont)...),
+		WithOverlays(overlays...),
+	)...)
+	if err != nil {
+		return err
+	}
+
+	panels := meme.panels()
+	panelImages := make([]draw.Image, len(panels))
+	style := renderer.Options().Style
+	for i, panel := range panels {
+		templateImage, err := load(panel.TemplateID)
+		if err != nil {
+			return err
+		}
+
+		top := Caption{Text: panel.Top, Style: panel.TopStyle.textStyle(style)}
+		bottom := Caption{Text: panel.Bottom, Style: panel.BottomStyle.textStyle(style)}
+
+		// SVG memes are validated to have single panel
+		if meme.Output.Format == FormatSVG {
+			return renderer.RenderSVG(w, templateImage, top, bottom)
+		}
+
+		panelImages[i], err = renderer.RenderCaptions(templateImage, top, bottom)
+		if err != nil {
+			return err
+		}
+	}
+
+	return meme.Output.encoder()(w, meme.composePanels(panelImages))
+}
+
+// meme returns meme of job with template file as its template id.
+func (j *RenderJob) meme() *Meme {
+	return &Meme{
+		TemplateID:  j.Template,
+		FontID:      j.FontID,
+		Top:         j.Top,
+		Bottom:      j.Bottom,
+		TopStyle:    j.TopStyle,
+		BottomStyle: j.BottomStyle,
+		Layout:      j.Layout,
+		BandColor:   j.BandColor,
+		Output:      j.Output,
+		Effects:     j.Effects,
+		Overlays:    j.Overlays,
+		TextBoxes:   j.TextBoxes,
+		Composition: j.Composition,
+		Panels:      j.Panels,
+		Gutter:      j.gutter(),
+		BorderColor: j.BorderColor,
+	}
+}
+
+// DecodeTemplate decodes template image and applies its EXIF orientation
+// like uploaded templates.
+func DecodeTemplate(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := normalizeTemplate(data, TemplateOptions{})
+	return img, err
+}
+
+// localFont returns registered font with given id, other ids are paths to
+// TrueType files which are read and registered under their path.
+func localFont(fontID string) (*truetype.Font, error) {
+	if fontID == "" {
+		fontID = DefaultFontID
+	}
+
+	if f, ok := Fonts.Font(fontID); ok {
+		return f, nil
+	}
+
+	fontBytes, err := ioutil.ReadFile(fontID)
+	if err != nil {
+		return nil, fmt.Errorf("reading font failed, error: %s", err)
+	}
+
+	f, err := Fonts.Register(fontID, fontBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing font %s failed, error: %s", fontID, err)
+	}
+
+	return f, nil
+}
+
+// registeredFallbackFonts returns meme font followed by fallback fonts
+// present in registry, nothing is loaded from cloud storage.
+func registeredFallbackFonts(memeFont *truetype.Font) FontSet {
+	fonts := FontSet{memeFont}
+	for _, fontID := range FallbackFontIDs {
+		if f, ok := Fonts.Font(fontID); ok && f != memeFont {
+			fonts = append(fonts, f)
+		}
+	}
+
+	return fonts
+}
@@ -0,0 +1,96 @@
+package memecreator
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRenderJobFromForm(t *testing.T) {
+	job, err := RenderJobFromForm(url.Values{
+		"template":  {"drake.jpg"},
+		"out":       {"out.png"},
+		"top":       {"TOP"},
+		"top_color": {"#ffcc00"},
+		"quality":   {"80"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Template != "drake.jpg" || job.Out != "out.png" || job.Top != "TOP" {
+		t.Errorf("job is %+v, want template, out and top from form", job)
+	}
+
+	if job.TopStyle.Color != "#ffcc00" || job.Output.Quality != 80 {
+		t.Errorf("job has top style %+v and output %+v, want flattened fields parsed", job.TopStyle, job.Output)
+	}
+}
+
+func TestRenderJobValidate(t *testing.T) {
+	for _, tt := range []struct {
+		job  RenderJob
+		errs int
+	}{
+		{RenderJob{Template: "t.png", CreateMemeCommand: CreateMemeCommand{Top: "TOP"}}, 0},
+		{RenderJob{CreateMemeCommand: CreateMemeCommand{Top: "TOP"}}, 1},
+		{RenderJob{Template: "t.png", CreateMemeCommand: CreateMemeCommand{TemplateID: "id", Top: "TOP"}}, 1},
+		{RenderJob{Template: "t.png", CreateMemeCommand: CreateMemeCommand{Top: "TOP", Overlays: []OverlaySpec{{X: 0.5, Y: 0.5}}}}, 1},
+		{RenderJob{Template: "t.png", CreateMemeCommand: CreateMemeCommand{
+			Composition: CompositionStrip,
+			Panels:      []PanelSpec{{TemplateID: "a.png", Top: "A"}, {TemplateID: "b.png", Top: "B"}},
+		}}, 1},
+		{RenderJob{Template: "t.png", CreateMemeCommand: CreateMemeCommand{Top: strings.Repeat("A", MaxCaptionLength+1)}}, 1},
+		{RenderJob{Template: "t.png", CreateMemeCommand: CreateMemeCommand{Top: "TOP", Layout: "sideways"}}, 1},
+	} {
+		if errs := tt.job.Validate(); len(errs) != tt.errs {
+			t.Errorf("job %+v has %d errors, want %d", tt.job, len(errs), tt.errs)
+		}
+	}
+}
+
+func TestRenderJobRender(t *testing.T) {
+	files := map[string]image.Image{
+		"a.png":       testTemplate(200, 100),
+		"b.png":       testTemplate(100, 100),
+		"sticker.png": testSticker(10, 10),
+	}
+	load := func(path string) (image.Image, error) {
+		if img, ok := files[path]; ok {
+			return img, nil
+		}
+		return nil, errors.New("file not found")
+	}
+
+	gutter := 5
+	job := &RenderJob{CreateMemeCommand: CreateMemeCommand{
+		Composition: CompositionStrip,
+		Gutter:      &gutter,
+		Panels:      []PanelSpec{{TemplateID: "a.png", Top: "A"}, {TemplateID: "b.png", Bottom: "B"}},
+		Overlays:    []OverlaySpec{{StickerID: "sticker.png", X: 0.5, Y: 0.5}},
+	}}
+
+	var buf bytes.Buffer
+	if err := job.Render(&buf, load); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decoding rendered meme failed, error: %s", err)
+	}
+
+	// panels of the same height side by side with gutter around them
+	if got, want := img.Bounds().Size(), image.Pt(315, 110); got != want {
+		t.Errorf("composed meme is %v, want %v", got, want)
+	}
+
+	job.Panels[1].TemplateID = "missing.png"
+	if err := job.Render(&buf, load); err == nil {
+		t.Errorf("rendering job with missing template succeeded")
+	}
+}
@@ -3,10 +3,14 @@ package memecreator
 import (
 	"encoding/json"
 	"fmt"
+	"image"
 	"io"
+	"io/ioutil"
 	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +23,10 @@ import (
 const (
 	// MemeKind is the name of kind in Datastore.
 	MemeKind = "Meme"
+
+	// MaxBatchSize is maximum number of memes created in single batch, it is
+	// limited by number of tasks added to queue in single call.
+	MaxBatchSize = 100
 )
 
 const (
@@ -26,27 +34,99 @@ const (
 	MemePublicURLPrefix = "https://storage.googleapis.com/dh-meme-creator.appspot.com"
 )
 
+const (
+	// MemeStatusQueued is status of meme waiting in queue for worker.
+	MemeStatusQueued = "queued"
+
+	// MemeStatusRendering is status of meme being rendered by worker.
+	MemeStatusRendering = "rendering"
+
+	// MemeStatusDone is status of meme which is rendered and stored.
+	MemeStatusDone = "done"
+
+	// MemeStatusFailed is status of meme which worker failed to render.
+	MemeStatusFailed = "failed"
+
+	// memeStatusCreated is status of queued memes stored before status
+	// transitions were tracked, it is reported as MemeStatusQueued.
+	memeStatusCreated = "created"
+)
+
+// memeStatus returns status of meme as reported by API.
+func memeStatus(status string) string {
+	if status == memeStatusCreated {
+		return MemeStatusQueued
+	}
+
+	return status
+}
+
 // Meme is type used for storing details about meme.
 type Meme struct {
-	Created    time.Time `json:"created"`
-	Status     string    `json:"status"`
-	TemplateID string    `json:"template_id"`
-	Top        string    `json:"top"`
-	Bottom     string    `json:"bottom"`
+	Created     time.Time     `json:"created"`
+	Status      string        `json:"status"`
+	TemplateID  string        `json:"template_id"`
+	FontID      string        `json:"font_id"`
+	Top         string        `json:"top"`
+	Bottom      string        `json:"bottom"`
+	TopStyle    CaptionStyle  `json:"top_style"`
+	BottomStyle CaptionStyle  `json:"bottom_style"`
+	Layout      string        `json:"layout,omitempty"`
+	BandColor   string        `json:"band_color,omitempty"`
+	Output      OutputFormat  `json:"output"`
+	Effects     []EffectSpec  `json:"effects,omitempty"`
+	Overlays    []OverlaySpec `json:"overlays,omitempty"`
+	TextBoxes   []TextBoxSpec `json:"text_boxes,omitempty"`
+	Composition string        `json:"composition,omitempty"`
+	Panels      []PanelSpec   `json:"panels,omitempty"`
+	Gutter      int           `json:"gutter,omitempty"`
+	BorderColor string        `json:"border_color,omitempty"`
+	Size        int64         `json:"size"`
+
+	// RequestedVariants are names of variants to store, all are stored when
+	// there are none
+	RequestedVariants []string `json:"requested_variants,omitempty"`
+
+	// VariantNames are names of stored variants, old memes have none
+	VariantNames []string `json:"-"`
 }
 
-// CreateMemeCommand is type used when creating new meme.
+// CreateMemeCommand is type used when creating new meme. Caption styles
+// override default styles of template. Composed memes have templates and
+// captions in panels instead.
 type CreateMemeCommand struct {
-	TemplateID string `json:"template_id"`
-	Top        string `json:"top"`
-	Bottom     string `json:"bottom"`
+	TemplateID  string        `json:"template_id"`
+	FontID      string        `json:"font_id"`
+	Top         string        `json:"top"`
+	Bottom      string        `json:"bottom"`
+	TopStyle    CaptionStyle  `json:"top_style"`
+	BottomStyle CaptionStyle  `json:"bottom_style"`
+	Layout      string        `json:"layout"`
+	BandColor   string        `json:"band_color"`
+	Output      OutputFormat  `json:"output"`
+	Effects     []EffectSpec  `json:"effects"`
+	Overlays    []OverlaySpec `json:"overlays"`
+	TextBoxes   []TextBoxSpec `json:"text_boxes"`
+	Composition string        `json:"composition"`
+	Panels      []PanelSpec   `json:"panels"`
+	Gutter      *int          `json:"gutter"`
+	BorderColor string        `json:"border_color"`
+	Variants    []string      `json:"variants"`
 }
 
-// MemeResponse is type returned as response from API.
+// BatchMemeResult is type returned for every item of batch create request.
+type BatchMemeResult struct {
+	ID    string    `json:"id,omitempty"`
+	Error *APIError `json:"error,omitempty"`
+}
+
+// MemeResponse is type returned as response from API. Variants map variant
+// names to their public urls.
 type MemeResponse struct {
 	ID string `json:"id"`
 	Meme
-	PublicURL string `json:"public_url"`
+	PublicURL string            `json:"public_url"`
+	Variants  map[string]string `json:"variants" datastore:"-"`
 }
 
 // MemesHandler handles actions getting existing memes or creating new meme.
@@ -57,9 +137,7 @@ func MemesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != http.MethodPost {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprint(w, `{"error":"method not allowed"}`)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -71,9 +149,7 @@ func GetMemesHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 
 	if r.Method != http.MethodGet {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprint(w, `{"error":"method not allowed"}`)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -84,15 +160,14 @@ func GetMemesHandler(w http.ResponseWriter, r *http.Request) {
 		GetAll(ctx, &memes)
 	if err != nil {
 		log.Errorf(ctx, "fetching meme from datastore failed, error %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
 	for i, m := range memes {
 		m.ID = keys[i].Encode()
-		m.PublicURL = fmt.Sprintf("%s/%s.png", MemePublicURLPrefix, m.ID)
+		m.Status = memeStatus(m.Status)
+		m.setURLs()
 	}
 
 	if memes == nil {
@@ -106,8 +181,7 @@ func GetMemesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Errorf(ctx, "fetching template from datastore failed, error %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 }
@@ -117,22 +191,20 @@ func PostMemesHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 
 	if r.Method != http.MethodPost {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprint(w, `{"error":"method not allowed"}`)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	contentType := r.Header.Get("Content-Type")
 	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(`{"error":"bad media type"}`))
+		writeError(w, r, http.StatusBadRequest, ErrorCodeBadMediaType, "bad media type")
 		return
 	}
 
 	cmd := new(CreateMemeCommand)
+	var templateFile multipart.File
+	var templateHandler *multipart.FileHeader
 
 	switch mediaType {
 	case "application/json":
@@ -141,35 +213,132 @@ func PostMemesHandler(w http.ResponseWriter, r *http.Request) {
 			if err := dec.Decode(&cmd); err == io.EOF {
 				break
 			} else if err != nil {
-				w.Header().Set("Content-Type", "application/json; charset=utf-8")
-				w.WriteHeader(http.StatusBadRequest)
-				w.Write([]byte(`{"error":"parsing request failed"}`))
+				writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
 				return
 			}
 		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
+			return
+		}
+
+		cmd, err = createMemeCommandFromForm(r.PostForm)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
+			return
+		}
+	case "multipart/form-data":
+		if !parseMultipartForm(ctx, w, r, MaxTemplateSize, ErrorCodeTemplateTooLarge, "template is too large") {
+			return
+		}
+
+		cmd, err = createMemeCommandFromForm(r.MultipartForm.Value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
+			return
+		}
+
+		templateFile, templateHandler, err = r.FormFile("template")
+		if err == http.ErrMissingFile {
+			templateFile = nil
+		} else if err != nil {
+			log.Errorf(ctx, "getting multipart form template object failed, error: %s", err)
+			writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
+			return
+		} else {
+			defer templateFile.Close()
+		}
 	default:
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(`{"error":"unsupported content type"}`))
+		writeError(w, r, http.StatusUnsupportedMediaType, ErrorCodeUnsupportedContentType, "unsupported content type")
+		return
+	}
+
+	// render endpoints accept format in query too, e.g. ?format=svg
+	formatFromQuery(r, cmd)
+
+	validationErrs, err := validateCreateMemeCommands(ctx, []*CreateMemeCommand{cmd}, templateFile != nil)
+	if err != nil {
+		log.Errorf(ctx, "validating meme failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
 
+	// inline template upload creates one-off private template, it is stored
+	// only for valid memes so no orphaned template is left behind
+	var templateBytes []byte
+	var master image.Image
+	var format string
+	if templateFile != nil {
+		templateBytes, err = ioutil.ReadAll(templateFile)
+		if err != nil {
+			log.Errorf(ctx, "reading template file failed, error: %s", err)
+			writeInternalError(w, r)
+			return
+		}
+
+		master, format, err = normalizeTemplate(templateBytes, TemplateOptions{})
+		if err != nil {
+			validationErrs[0] = append(validationErrs[0], &ValidationError{
+				Field:   "template",
+				Message: err.Error(),
+			})
+		}
+	}
+
+	if len(validationErrs[0]) > 0 {
+		writeAPIError(w, r, &APIError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidationFailed,
+			Message: "meme is invalid",
+			Details: validationErrs[0],
+		})
+		return
+	}
+
+	if templateFile != nil {
+		templateKey, err := storeTemplate(ctx, &Template{
+			Filename: templateHandler.Filename,
+			Private:  true,
+		}, templateBytes, master, format)
+		if err != nil {
+			log.Errorf(ctx, "storing private template failed, error: %s", err)
+			writeInternalError(w, r)
+			return
+		}
+
+		cmd.TemplateID = templateKey.Encode()
+	}
+
 	memeKey, err := datastore.Put(
 		ctx,
 		datastore.NewIncompleteKey(ctx, MemeKind, nil),
 		&Meme{
-			Created:    time.Now(),
-			Status:     "created",
-			TemplateID: cmd.TemplateID,
-			Top:        cmd.Top,
-			Bottom:     cmd.Bottom,
+			Created:     time.Now(),
+			Status:      MemeStatusQueued,
+			TemplateID:  cmd.TemplateID,
+			FontID:      cmd.FontID,
+			Top:         cmd.Top,
+			Bottom:      cmd.Bottom,
+			TopStyle:    cmd.TopStyle,
+			BottomStyle: cmd.BottomStyle,
+			Layout:      cmd.Layout,
+			BandColor:   cmd.BandColor,
+			Output:      cmd.Output,
+			Effects:     cmd.Effects,
+			Overlays:    cmd.Overlays,
+			TextBoxes:   cmd.TextBoxes,
+			Composition: cmd.Composition,
+			Panels:      cmd.Panels,
+			Gutter:      cmd.gutter(),
+			BorderColor: cmd.BorderColor,
+
+			RequestedVariants: cmd.Variants,
 		},
 	)
 	if err != nil {
 		log.Errorf(ctx, "storing meme in datastore failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
@@ -179,39 +348,124 @@ func PostMemesHandler(w http.ResponseWriter, r *http.Request) {
 
 	if _, err := taskqueue.Add(ctx, createMemeTask, ""); err != nil {
 		log.Errorf(ctx, "adding task in queue failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
+	publishMemeStatus(memeKey.Encode(), MemeStatusQueued)
+
 	w.Header().Set("Location", fmt.Sprintf("/memes/%s", memeKey.Encode()))
 	w.WriteHeader(http.StatusCreated)
 }
 
+// createMemeCommandFromForm creates command from form values, field names
+// are the same as in JSON request and caption style and output fields are
+// flattened, e.g. top_transform or quality. Effects, overlays, text boxes
+// and panels are JSON arrays.
+func createMemeCommandFromForm(form url.Values) (*CreateMemeCommand, error) {
+	topStyle, err := captionStyleFromForm(form, "top")
+	if err != nil {
+		return nil, err
+	}
+
+	bottomStyle, err := captionStyleFromForm(form, "bottom")
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := outputFormatFromForm(form)
+	if err != nil {
+		return nil, err
+	}
+
+	// effects are ordered list with parameters, so they are sent as JSON
+	var effects []EffectSpec
+	if v := form.Get("effects"); v != "" {
+		if err := json.Unmarshal([]byte(v), &effects); err != nil {
+			return nil, fmt.Errorf("parsing effects failed, error: %s", err)
+		}
+	}
+
+	var overlays []OverlaySpec
+	if v := form.Get("overlays"); v != "" {
+		if err := json.Unmarshal([]byte(v), &overlays); err != nil {
+			return nil, fmt.Errorf("parsing overlays failed, error: %s", err)
+		}
+	}
+
+	var textBoxes []TextBoxSpec
+	if v := form.Get("text_boxes"); v != "" {
+		if err := json.Unmarshal([]byte(v), &textBoxes); err != nil {
+			return nil, fmt.Errorf("parsing text boxes failed, error: %s", err)
+		}
+	}
+
+	var panels []PanelSpec
+	if v := form.Get("panels"); v != "" {
+		if err := json.Unmarshal([]byte(v), &panels); err != nil {
+			return nil, fmt.Errorf("parsing panels failed, error: %s", err)
+		}
+	}
+
+	var gutter *int
+	if v := form.Get("gutter"); v != "" {
+		g, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing gutter failed, error: %s", err)
+		}
+		gutter = &g
+	}
+
+	var variants []string
+	if v := form.Get("variants"); v != "" {
+		variants = strings.Split(v, ",")
+	}
+
+	return &CreateMemeCommand{
+		TemplateID:  form.Get("template_id"),
+		FontID:      form.Get("font_id"),
+		Top:         form.Get("top"),
+		Bottom:      form.Get("bottom"),
+		TopStyle:    topStyle,
+		BottomStyle: bottomStyle,
+		Layout:      form.Get("layout"),
+		BandColor:   form.Get("band_color"),
+		Output:      output,
+		Effects:     effects,
+		Overlays:    overlays,
+		TextBoxes:   textBoxes,
+		Composition: form.Get("composition"),
+		Panels:      panels,
+		Gutter:      gutter,
+		BorderColor: form.Get("border_color"),
+		Variants:    variants,
+	}, nil
+}
+
 // MemeHandler handles getting existing meme.
 func MemeHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 
+	if strings.HasSuffix(r.URL.Path, "/events") {
+		MemeEventsHandler(w, r)
+		return
+	}
+
 	if r.Method != http.MethodGet {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprint(w, `{"error":"method not allowed"}`)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	u, err := url.Parse(r.RequestURI)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "meme not found")
 		return
 	}
 
 	memeID := strings.TrimPrefix(u.Path, "/memes/")
 	memeKey, err := datastore.DecodeKey(memeID)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "meme not found")
 		return
 	}
 
@@ -221,20 +475,20 @@ func MemeHandler(w http.ResponseWriter, r *http.Request) {
 		memeKey,
 		&meme,
 	); err == datastore.ErrNoSuchEntity {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "meme not found")
 		return
 	} else if err != nil {
 		log.Errorf(ctx, "getting meme from datastore failed, error: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
+	meme.Status = memeStatus(meme.Status)
 	mr := MemeResponse{
-		ID:        memeID,
-		Meme:      meme,
-		PublicURL: fmt.Sprintf("%s/%s.png", MemePublicURLPrefix, memeID),
+		ID:   memeID,
+		Meme: meme,
 	}
+	mr.setURLs()
 
 	resp := map[string]interface{}{
 		"meme": mr,
@@ -243,8 +497,199 @@ func MemeHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Errorf(ctx, "fetching meme from datastore failed, error %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
+		return
+	}
+}
+
+// PostMemesBatchHandler handles creating multiple memes at once. All commands
+// are validated before anything is stored, then memes are stored in single
+// multi-put and their tasks are added to queue in bulk.
+func PostMemesBatchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeBadMediaType, "bad media type")
+		return
+	}
+
+	if mediaType != "application/json" {
+		writeError(w, r, http.StatusUnsupportedMediaType, ErrorCodeUnsupportedContentType, "unsupported content type")
+		return
+	}
+
+	var cmds []*CreateMemeCommand
+	if err := json.NewDecoder(r.Body).Decode(&cmds); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
+		return
+	}
+
+	if len(cmds) == 0 || len(cmds) > MaxBatchSize {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeBatchTooLarge, fmt.Sprintf("batch must contain 1 to %d memes", MaxBatchSize))
+		return
+	}
+
+	formatFromQuery(r, cmds...)
+
+	validationErrs, err := validateCreateMemeCommands(ctx, cmds, false)
+	if err != nil {
+		log.Errorf(ctx, "validating memes failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	results := make([]*BatchMemeResult, len(cmds))
+	valid := true
+	for i := range cmds {
+		results[i] = &BatchMemeResult{}
+		if len(validationErrs[i]) > 0 {
+			results[i].Error = &APIError{
+				Status:  http.StatusBadRequest,
+				Code:    ErrorCodeValidationFailed,
+				Message: "meme is invalid",
+				Details: validationErrs[i],
+			}
+			valid = false
+		}
+	}
+
+	if !valid {
+		writeBatchMemeResults(w, r, http.StatusBadRequest, results)
+		return
+	}
+
+	now := time.Now()
+	keys := make([]*datastore.Key, len(cmds))
+	memes := make([]*Meme, len(cmds))
+	for i, cmd := range cmds {
+		keys[i] = datastore.NewIncompleteKey(ctx, MemeKind, nil)
+		memes[i] = &Meme{
+			Created:     now,
+			Status:      MemeStatusQueued,
+			TemplateID:  cmd.TemplateID,
+			FontID:      cmd.FontID,
+			Top:         cmd.Top,
+			Bottom:      cmd.Bottom,
+			TopStyle:    cmd.TopStyle,
+			BottomStyle: cmd.BottomStyle,
+			Layout:      cmd.Layout,
+			BandColor:   cmd.BandColor,
+			Output:      cmd.Output,
+			Effects:     cmd.Effects,
+			Overlays:    cmd.Overlays,
+			TextBoxes:   cmd.TextBoxes,
+			Composition: cmd.Composition,
+			Panels:      cmd.Panels,
+			Gutter:      cmd.gutter(),
+			BorderColor: cmd.BorderColor,
+
+			RequestedVariants: cmd.Variants,
+		}
+	}
+
+	memeKeys, err := datastore.PutMulti(ctx, keys, memes)
+	if err != nil {
+		log.Errorf(ctx, "storing memes in datastore failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	tasks := make([]*taskqueue.Task, len(memeKeys))
+	for i, memeKey := range memeKeys {
+		results[i].ID = memeKey.Encode()
+		tasks[i] = taskqueue.NewPOSTTask("/worker", url.Values{
+			"meme_id": []string{memeKey.Encode()},
+		})
+	}
+
+	_, err = taskqueue.AddMulti(ctx, tasks, "")
+	if err != nil {
+		log.Errorf(ctx, "adding tasks in queue failed, error: %s", err)
+	}
+
+	// memes without task would stay queued forever, mark them failed instead
+	var failedKeys []*datastore.Key
+	var failedMemes []*Meme
+	for _, i := range markEnqueueFailures(results, memes, taskErrors(err, len(tasks))) {
+		failedKeys = append(failedKeys, memeKeys[i])
+		failedMemes = append(failedMemes, memes[i])
+	}
+
+	if len(failedKeys) > 0 {
+		if _, err := datastore.PutMulti(ctx, failedKeys, failedMemes); err != nil {
+			log.Errorf(ctx, "updating memes in datastore failed, error: %s", err)
+		}
+
+		writeBatchMemeResults(w, r, http.StatusMultiStatus, results)
+		return
+	}
+
+	writeBatchMemeResults(w, r, http.StatusCreated, results)
+}
+
+// taskErrors returns error of every task added by taskqueue.AddMulti which
+// returned err.
+func taskErrors(err error, n int) []error {
+	errs := make([]error, n)
+	if me, ok := err.(appengine.MultiError); ok {
+		copy(errs, me)
+	} else if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
+// markEnqueueFailures sets error results of memes whose task wasn't added to
+// queue and marks them failed, queued status of the others is published. It
+// returns indexes of failed memes.
+func markEnqueueFailures(results []*BatchMemeResult, memes []*Meme, taskErrs []error) []int {
+	var failed []int
+	for i, taskErr := range taskErrs {
+		if taskErr == nil {
+			publishMemeStatus(results[i].ID, MemeStatusQueued)
+			continue
+		}
+
+		results[i].Error = &APIError{
+			Status:  http.StatusInternalServerError,
+			Code:    ErrorCodeEnqueueFailed,
+			Message: "adding meme to queue failed",
+		}
+		memes[i].Status = MemeStatusFailed
+		failed = append(failed, i)
+	}
+
+	return failed
+}
+
+// writeBatchMemeResults writes results of batch request with given status.
+func writeBatchMemeResults(w http.ResponseWriter, r *http.Request, status int, results []*BatchMemeResult) {
+	ctx := appengine.NewContext(r)
+
+	for _, result := range results {
+		if result.Error != nil {
+			result.Error.RequestID = appengine.RequestID(ctx)
+		}
+	}
+
+	resp := map[string]interface{}{
+		"memes": results,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf(ctx, "encoding batch results failed, error %s", err)
 		return
 	}
 }
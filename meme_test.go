@@ -0,0 +1,200 @@
+package memecreator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/appengine"
+)
+
+// inlineMemeRequest returns multipart create meme request with form fields
+// and PNG template file.
+func inlineMemeRequest(t *testing.T, fields map[string]string) *http.Request {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fw, err := mw.CreateFormFile("template", "template.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(fw, testTemplate(40, 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/memes", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+// TestPostMemesInlineTemplateInvalidFont checks that inline template upload
+// is rejected before template is stored, storing it would fail outside of
+// App Engine with internal error instead.
+func TestPostMemesInlineTemplateInvalidFont(t *testing.T) {
+	w := httptest.NewRecorder()
+	PostMemesHandler(w, inlineMemeRequest(t, map[string]string{
+		"top":     "TOP",
+		"font_id": "Not A Font",
+	}))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status is %d, want %d, body: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+
+	if apiErr := decodeAPIError(t, w); len(apiErr.Details) != 1 || apiErr.Details[0].Field != "font_id" {
+		t.Errorf("error details are %+v, want single font_id error", apiErr.Details)
+	}
+}
+
+// decodeAPIError decodes error of error response.
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) *APIError {
+	t.Helper()
+
+	var resp struct {
+		Error *APIError `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Error == nil {
+		t.Fatalf("decoding error response failed, error: %v", err)
+	}
+
+	return resp.Error
+}
+
+func TestMemeStatus(t *testing.T) {
+	for status, want := range map[string]string{
+		"created":           MemeStatusQueued,
+		MemeStatusQueued:    MemeStatusQueued,
+		MemeStatusRendering: MemeStatusRendering,
+		MemeStatusDone:      MemeStatusDone,
+		MemeStatusFailed:    MemeStatusFailed,
+	} {
+		if got := memeStatus(status); got != want {
+			t.Errorf("status %s is reported as %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestPostMemesBatchHandler(t *testing.T) {
+	tooLarge := "[" + strings.TrimSuffix(strings.Repeat(`{"top":"A"},`, MaxBatchSize+1), ",") + "]"
+
+	for _, tt := range []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		status      int
+		code        string
+		// error fields of every item of validation error response
+		fields [][]string
+	}{
+		{"method", "GET", "application/json", "", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, nil},
+		{"content type", "POST", "text/plain", "[]", http.StatusUnsupportedMediaType, ErrorCodeUnsupportedContentType, nil},
+		{"malformed", "POST", "application/json", "{", http.StatusBadRequest, ErrorCodeInvalidRequest, nil},
+		{"empty", "POST", "application/json", "[]", http.StatusBadRequest, ErrorCodeBatchTooLarge, nil},
+		{"too large", "POST", "application/json", tooLarge, http.StatusBadRequest, ErrorCodeBatchTooLarge, nil},
+		{"invalid", "POST", "application/json", `[{"top":"A"},{"template_id":"drake"},null]`, http.StatusBadRequest, "", [][]string{
+			{"template_id"},
+			{"top", "template_id"},
+			{""},
+		}},
+	} {
+		r := httptest.NewRequest(tt.method, "/memes:batch", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		PostMemesBatchHandler(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s batch has status %d, want %d, body: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+
+		if tt.fields == nil {
+			if apiErr := decodeAPIError(t, w); apiErr.Code != tt.code {
+				t.Errorf("%s batch has error %q, want %q", tt.name, apiErr.Code, tt.code)
+			}
+			continue
+		}
+
+		var resp struct {
+			Memes []*BatchMemeResult `json:"memes"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resp.Memes) != len(tt.fields) {
+			t.Fatalf("%s batch has %d results, want %d", tt.name, len(resp.Memes), len(tt.fields))
+		}
+
+		for i, result := range resp.Memes {
+			var fields []string
+			if result.Error != nil && result.Error.Code == ErrorCodeValidationFailed {
+				for _, detail := range result.Error.Details {
+					fields = append(fields, detail.Field)
+				}
+			}
+
+			if result.ID != "" || strings.Join(fields, ",") != strings.Join(tt.fields[i], ",") {
+				t.Errorf("%s batch item %d has id %q and error fields %v, want no id and %v", tt.name, i, result.ID, fields, tt.fields[i])
+			}
+		}
+	}
+}
+
+func TestTaskErrors(t *testing.T) {
+	failed := errors.New("queue is full")
+
+	for _, tt := range []struct {
+		err  error
+		want []error
+	}{
+		{nil, []error{nil, nil}},
+		{failed, []error{failed, failed}},
+		{appengine.MultiError{nil, failed}, []error{nil, failed}},
+	} {
+		got := taskErrors(tt.err, 2)
+		if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+			t.Errorf("task errors of %v are %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestMarkEnqueueFailures(t *testing.T) {
+	results := []*BatchMemeResult{{ID: "meme-1"}, {ID: "meme-2"}, {ID: "meme-3"}}
+	memes := []*Meme{{Status: MemeStatusQueued}, {Status: MemeStatusQueued}, {Status: MemeStatusQueued}}
+
+	failed := markEnqueueFailures(results, memes, []error{nil, errors.New("queue is full"), nil})
+
+	if len(failed) != 1 || failed[0] != 1 {
+		t.Errorf("failed memes are %v, want [1]", failed)
+	}
+
+	for i, want := range []string{MemeStatusQueued, MemeStatusFailed, MemeStatusQueued} {
+		if memes[i].Status != want {
+			t.Errorf("meme %d is %s, want %s", i, memes[i].Status, want)
+		}
+
+		// every result keeps its id, failed ones get error too
+		if results[i].ID == "" || (results[i].Error != nil) != (want == MemeStatusFailed) {
+			t.Errorf("result %d is %+v, want id with error only when failed", i, results[i])
+		}
+	}
+
+	if code := results[1].Error.Code; code != ErrorCodeEnqueueFailed {
+		t.Errorf("failed result has error %q, want %q", code, ErrorCodeEnqueueFailed)
+	}
+}
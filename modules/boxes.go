@@ -0,0 +1,153 @@
+package memecreator
+
+import (
+	"fmt"
+
+	"golang.org/x/image/math/f64"
+)
+
+const (
+	// MaxTextBoxes is maximum number of text boxes of single meme.
+	MaxTextBoxes = 10
+)
+
+// Point is position relative to template size, 0,0 is top left and 1,1
+// bottom right corner.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// QuadSpec is type used for storing corners of text box drawn in
+// perspective.
+type QuadSpec struct {
+	TopLeft     Point `json:"top_left"`
+	TopRight    Point `json:"top_right"`
+	BottomRight Point `json:"bottom_right"`
+	BottomLeft  Point `json:"bottom_left"`
+}
+
+// TextBoxSpec is type used for storing caption placed in box over template,
+// e.g. on sign at an angle. Box is given by center, size and clockwise
+// rotation in degrees, or by quad when any of its corners is set. Position
+// and size are relative to template size.
+type TextBoxSpec struct {
+	Text     string       `json:"text"`
+	Style    CaptionStyle `json:"style"`
+	X        float64      `json:"x"`
+	Y        float64      `json:"y"`
+	Width    float64      `json:"width"`
+	Height   float64      `json:"height"`
+	Rotation float64      `json:"rotation,omitempty"`
+	Quad     QuadSpec     `json:"quad"`
+}
+
+// corners returns quad corners in renderer order.
+func (q QuadSpec) corners() [4]f64.Vec2 {
+	return [4]f64.Vec2{
+		{q.TopLeft.X, q.TopLeft.Y},
+		{q.TopRight.X, q.TopRight.Y},
+		{q.BottomRight.X, q.BottomRight.Y},
+		{q.BottomLeft.X, q.BottomLeft.Y},
+	}
+}
+
+// textBoxes returns renderer text boxes of specs with styles based on
+// renderer style base.
+func textBoxes(specs []TextBoxSpec, base TextStyle) []TextBox {
+	boxes := make([]TextBox, len(specs))
+	for i, spec := range specs {
+		boxes[i] = TextBox{
+			Caption: Caption{
+				Text:  spec.Text,
+				Style: spec.Style.textStyle(base),
+			},
+			X:        spec.X,
+			Y:        spec.Y,
+			Width:    spec.Width,
+			Height:   spec.Height,
+			Rotation: spec.Rotation,
+			Quad:     spec.Quad.corners(),
+		}
+	}
+
+	return boxes
+}
+
+// validateTextBoxes checks captions and styles of text boxes and that boxes
+// are within template. Quads must be convex with corners in clockwise order.
+func validateTextBoxes(boxes []TextBoxSpec) []*ValidationError {
+	var errs []*ValidationError
+
+	if len(boxes) > MaxTextBoxes {
+		errs = append(errs, &ValidationError{
+			Field:   "text_boxes",
+			Message: fmt.Sprintf("meme can have at most %d text boxes", MaxTextBoxes),
+		})
+	}
+
+	for i, box := range boxes {
+		field := fmt.Sprintf("text_boxes[%d]", i)
+
+		if err := validateCaption(box.Text); err != "" {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".text",
+				Message: err,
+			})
+		}
+
+		errs = append(errs, validateCaptionStyle(field+".style", box.Style)...)
+
+		if box.Quad != (QuadSpec{}) {
+			if !validQuad(box.Quad.corners()) {
+				errs = append(errs, &ValidationError{
+					Field:   field + ".quad",
+					Message: "quad must be convex with corners between 0 and 1 in order top left, top right, bottom right and bottom left",
+				})
+			}
+			continue
+		}
+
+		if !(box.X >= 0 && box.X <= 1 && box.Y >= 0 && box.Y <= 1) {
+			errs = append(errs, &ValidationError{
+				Field:   field,
+				Message: "position must be between 0 and 1",
+			})
+		}
+
+		if !(box.Width > 0 && box.Width <= 1 && box.Height > 0 && box.Height <= 1) {
+			errs = append(errs, &ValidationError{
+				Field:   field,
+				Message: "width and height must be greater than 0 and at most 1",
+			})
+		}
+
+		if !(box.Rotation >= -360 && box.Rotation <= 360) {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".rotation",
+				Message: "rotation must be between -360 and 360 degrees",
+			})
+		}
+	}
+
+	return errs
+}
+
+// validQuad reports whether quad corners are within template and form
+// convex quad in clockwise order, with y axis pointing down.
+func validQuad(quad [4]f64.Vec2) bool {
+	for i, p := range quad {
+		if !(p[0] >= 0 && p[0] <= 1 && p[1] >= 0 && p[1] <= 1) {
+			return false
+		}
+
+		// cross product of edges at every corner has the same sign
+		prev, next := quad[(i+3)%4], quad[(i+1)%4]
+		cross := (p[0]-prev[0])*(next[1]-p[1]) - (p[1]-prev[1])*(next[0]-p[0])
+		if !(cross > 1e-9) {
+			return false
+		}
+	}
+
+	return true
+}
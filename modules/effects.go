@@ -0,0 +1,121 @@
+package memecreator
+
+import (
+	"fmt"
+)
+
+const (
+	// MaxEffects is maximum number of effects of single meme.
+	MaxEffects = 10
+
+	// EffectStageBefore applies effect to template before captions.
+	EffectStageBefore = "before"
+
+	// EffectStageAfter applies effect to whole meme including captions, it
+	// is default stage.
+	EffectStageAfter = "after"
+)
+
+// effectKind describes effect available in API with default and allowed
+// range of its amount.
+type effectKind struct {
+	defaultAmount float64
+	min, max      float64
+	effect        func(amount float64, seed int64) Effect
+}
+
+// effectKinds maps effect names used in API to effects. Meaning of amount
+// differs by effect, see EffectSpec.
+var effectKinds = map[string]effectKind{
+	"grayscale":  {1, 0, 1, func(a float64, _ int64) Effect { return Grayscale(a) }},
+	"sepia":      {1, 0, 1, func(a float64, _ int64) Effect { return Sepia(a) }},
+	"blur":       {3, 0.5, 50, func(a float64, _ int64) Effect { return GaussianBlur(a) }},
+	"pixelate":   {8, 2, 256, func(a float64, _ int64) Effect { return Pixelate(int(a)) }},
+	"saturation": {1.5, 0, 5, func(a float64, _ int64) Effect { return Saturation(a) }},
+	"contrast":   {1.5, 0, 5, func(a float64, _ int64) Effect { return Contrast(a) }},
+	"noise":      {0.1, 0, 1, Noise},
+	"jpeg":       {10, 1, 100, func(a float64, _ int64) Effect { return JPEGCrush(int(a), 3) }},
+	"deep_fried": {1, 0.1, 5, DeepFry},
+}
+
+// EffectSpec is type used for storing single effect of meme. Amount is
+// strength of grayscale and sepia from 0 to 1, sigma of blur and block size
+// of pixelate in pixels, factor of saturation and contrast, deviation of
+// noise from 0 to 1, JPEG quality of jpeg and intensity of deep_fried.
+// Zero amount uses default of effect.
+type EffectSpec struct {
+	Name   string  `json:"name"`
+	Stage  string  `json:"stage,omitempty"`
+	Amount float64 `json:"amount,omitempty"`
+}
+
+// renderEffects returns renderer option with effects of meme split by stage.
+// Every effect gets its position as noise seed, so re-rendering meme gives
+// the same image.
+func renderEffects(specs []EffectSpec) RenderOption {
+	var pre, post []Effect
+	for i, spec := range specs {
+		kind, ok := effectKinds[spec.Name]
+		if !ok {
+			continue
+		}
+
+		amount := spec.Amount
+		if amount == 0 {
+			amount = kind.defaultAmount
+		}
+
+		effect := kind.effect(amount, int64(i))
+		if spec.Stage == EffectStageBefore {
+			pre = append(pre, effect)
+		} else {
+			post = append(post, effect)
+		}
+	}
+
+	return WithEffects(pre, post)
+}
+
+// validateEffects checks that effects are known, in known stage and their
+// amounts are within limits.
+func validateEffects(specs []EffectSpec) []*ValidationError {
+	var errs []*ValidationError
+
+	if len(specs) > MaxEffects {
+		errs = append(errs, &ValidationError{
+			Field:   "effects",
+			Message: fmt.Sprintf("meme can have at most %d effects", MaxEffects),
+		})
+	}
+
+	for i, spec := range specs {
+		field := fmt.Sprintf("effects[%d]", i)
+
+		kind, ok := effectKinds[spec.Name]
+		if !ok {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".name",
+				Message: "effect must be one of grayscale, sepia, blur, pixelate, saturation, contrast, noise, jpeg or deep_fried",
+			})
+			continue
+		}
+
+		switch spec.Stage {
+		case "", EffectStageBefore, EffectStageAfter:
+		default:
+			errs = append(errs, &ValidationError{
+				Field:   field + ".stage",
+				Message: "stage must be one of before or after",
+			})
+		}
+
+		if spec.Amount != 0 && !(spec.Amount >= kind.min && spec.Amount <= kind.max) {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".amount",
+				Message: fmt.Sprintf("amount of %s must be between %v and %v", spec.Name, kind.min, kind.max),
+			})
+		}
+	}
+
+	return errs
+}
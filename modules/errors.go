@@ -0,0 +1,172 @@
+package memecreator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+)
+
+// Error codes returned in code field of every API error. Clients should
+// depend on code, message is human readable description which may change.
+//
+//	method_not_allowed        405 HTTP method is not supported by endpoint
+//	forbidden                 403 endpoint is available only to admins
+//	not_found                 404 resource does not exist or its id is malformed
+//	bad_media_type            400 Content-Type header can't be parsed
+//	unsupported_content_type  415 Content-Type is not accepted by endpoint
+//	invalid_request           400 request body can't be parsed
+//	validation_failed         400 request is well-formed but some fields are invalid, see details
+//	batch_too_large           400 batch is empty or has more items than allowed
+//	template_too_large        400 uploaded template exceeds MaxTemplateSize
+//	missing_template_file     400 multipart request has no template file
+//	font_too_large            400 uploaded font exceeds MaxFontSize
+//	missing_font_file         400 multipart request has no font file
+//	sticker_too_large         400 uploaded sticker exceeds MaxTemplateSize
+//	missing_sticker_file      400 multipart request has no sticker file
+//	streaming_not_supported   500 connection doesn't support Server-Sent Events
+//	enqueue_failed            500 meme was stored but adding it to queue failed
+//	internal                  500 unexpected server error, retry later
+const (
+	ErrorCodeMethodNotAllowed       = "method_not_allowed"
+	ErrorCodeForbidden              = "forbidden"
+	ErrorCodeNotFound               = "not_found"
+	ErrorCodeBadMediaType           = "bad_media_type"
+	ErrorCodeUnsupportedContentType = "unsupported_content_type"
+	ErrorCodeInvalidRequest         = "invalid_request"
+	ErrorCodeValidationFailed       = "validation_failed"
+	ErrorCodeBatchTooLarge          = "batch_too_large"
+	ErrorCodeTemplateTooLarge       = "template_too_large"
+	ErrorCodeMissingTemplateFile    = "missing_template_file"
+	ErrorCodeFontTooLarge           = "font_too_large"
+	ErrorCodeMissingFontFile        = "missing_font_file"
+	ErrorCodeStickerTooLarge        = "sticker_too_large"
+	ErrorCodeMissingStickerFile     = "missing_sticker_file"
+	ErrorCodeStreamingNotSupported  = "streaming_not_supported"
+	ErrorCodeEnqueueFailed          = "enqueue_failed"
+	ErrorCodeInternal               = "internal"
+)
+
+// APIError is type returned as error response from API.
+type APIError struct {
+	Status    int                `json:"-"`
+	Code      string             `json:"code"`
+	Message   string             `json:"message"`
+	Details   []*ValidationError `json:"details,omitempty"`
+	RequestID string             `json:"request_id,omitempty"`
+}
+
+// Error implements error interface.
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// writeError writes error response with given status, code and message.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeAPIError(w, r, &APIError{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// writeInternalError writes generic internal server error response.
+func writeInternalError(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusInternalServerError, ErrorCodeInternal, "something went wrong ;(")
+}
+
+// writeAPIError is the single place writing error responses, it fills
+// request id, sets headers and status and encodes error as JSON.
+func writeAPIError(w http.ResponseWriter, r *http.Request, e *APIError) {
+	ctx := appengine.NewContext(r)
+
+	if e.RequestID == "" {
+		e.RequestID = appengine.RequestID(ctx)
+	}
+
+	resp := map[string]interface{}{
+		"error": e,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf(ctx, "encoding error response failed, error %s", err)
+	}
+}
+
+// maxFormFieldsSize is allowance for form fields of multipart requests on
+// top of size limit of uploaded file.
+const maxFormFieldsSize = 1 << 20
+
+// limitedBody is request body limited by http.MaxBytesReader which records
+// whether reading failed because the limit was exceeded.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+// Read implements io.Reader interface.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		b.exceeded = true
+	}
+
+	return n, err
+}
+
+// parseMultipartForm parses multipart request with file of at most maxSize
+// bytes and writes error response when it fails. Requests over the limit are
+// reported with tooLargeCode and message, other failures as invalid request.
+// It returns false when error response was written.
+func parseMultipartForm(ctx context.Context, w http.ResponseWriter, r *http.Request, maxSize int64, tooLargeCode, tooLargeMessage string) bool {
+	tooLarge, err := readMultipartForm(w, r, maxSize)
+	if err == nil {
+		return true
+	}
+
+	log.Errorf(ctx, "parsing multipart form failed, error: %s", err)
+	if tooLarge {
+		writeError(w, r, http.StatusBadRequest, tooLargeCode, tooLargeMessage)
+	} else {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
+	}
+
+	return false
+}
+
+// readMultipartForm parses multipart request with files of at most maxSize
+// bytes, it reports whether parsing failed because the request or one of its
+// files is too large.
+func readMultipartForm(w http.ResponseWriter, r *http.Request, maxSize int64) (bool, error) {
+	body := &limitedBody{
+		ReadCloser: http.MaxBytesReader(w, r.Body, maxSize+maxFormFieldsSize),
+		limit:      maxSize + maxFormFieldsSize,
+	}
+	r.Body = body
+
+	// maxSize is only memory threshold of parsing, body limit allows files
+	// slightly larger than maxSize, so their sizes are checked too
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		return body.exceeded, err
+	}
+
+	for field, files := range r.MultipartForm.File {
+		for _, fh := range files {
+			if fh.Size > maxSize {
+				return true, fmt.Errorf("file %s of field %s has %d bytes, maximum is %d", fh.Filename, field, fh.Size, maxSize)
+			}
+		}
+	}
+
+	return false, nil
+}
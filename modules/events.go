@@ -0,0 +1,276 @@
+package memecreator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+const (
+	// MemeEventsBufferSize is number of events buffered for each subscriber.
+	MemeEventsBufferSize = 16
+
+	// MemeEventsKeepAlive is interval of keep-alive comments sent to clients.
+	MemeEventsKeepAlive = 15 * time.Second
+
+	// MemeEventsPollInterval is interval of reading status of streamed meme
+	// from datastore, it catches transitions published on other instances.
+	MemeEventsPollInterval = 5 * time.Second
+)
+
+// MemeEvents is in-process broker used by worker for publishing meme status
+// transitions. Only subscribers running in the same instance as the worker
+// receive the events, single meme streams poll datastore for the others.
+var MemeEvents = NewMemeBroker()
+
+// MemeEvent is type used for publishing meme status transition.
+type MemeEvent struct {
+	MemeID string    `json:"meme_id"`
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+// MemeBroker is simple pub/sub broker for meme events.
+type MemeBroker struct {
+	mu   sync.Mutex
+	subs map[chan MemeEvent]string
+}
+
+// NewMemeBroker creates new empty broker.
+func NewMemeBroker() *MemeBroker {
+	return &MemeBroker{
+		subs: make(map[chan MemeEvent]string),
+	}
+}
+
+// Subscribe registers subscriber for events of meme with given id, empty id
+// subscribes to events of all memes. Returned function cancels subscription.
+func (b *MemeBroker) Subscribe(memeID string) (<-chan MemeEvent, func()) {
+	ch := make(chan MemeEvent, MemeEventsBufferSize)
+
+	b.mu.Lock()
+	b.subs[ch] = memeID
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish sends event to all matching subscribers. Slow subscribers with full
+// buffer miss the event instead of blocking publisher.
+func (b *MemeBroker) Publish(e MemeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch, memeID := range b.subs {
+		if memeID != "" && memeID != e.MemeID {
+			continue
+		}
+
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// MemesEventsHandler streams status transitions of all memes as Server-Sent Events.
+func MemesEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	events, cancel := MemeEvents.Subscribe("")
+	defer cancel()
+
+	streamMemeEvents(w, r, events, nil, nil)
+}
+
+// MemeEventsHandler streams status transitions of single meme as Server-Sent Events.
+// Stream ends once meme is done or failed. Worker may run on other instance,
+// so status is also read from datastore every MemeEventsPollInterval.
+func MemeEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	memeID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/memes/"), "/events")
+	memeKey, err := datastore.DecodeKey(memeID)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "meme not found")
+		return
+	}
+
+	// subscribe before reading current status so no transition gets lost
+	events, cancel := MemeEvents.Subscribe(memeID)
+	defer cancel()
+
+	var meme Meme
+	if err := datastore.Get(
+		ctx,
+		memeKey,
+		&meme,
+	); err == datastore.ErrNoSuchEntity {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "meme not found")
+		return
+	} else if err != nil {
+		log.Errorf(ctx, "getting meme from datastore failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	streamMemeEvents(w, r, events, &MemeEvent{
+		MemeID: memeID,
+		Status: memeStatus(meme.Status),
+		Time:   time.Now(),
+	}, &memeStatusPoll{
+		interval: MemeEventsPollInterval,
+		status: func() (string, error) {
+			var meme Meme
+			if err := datastore.Get(
+				ctx,
+				memeKey,
+				&meme,
+			); err != nil {
+				return "", err
+			}
+
+			return memeStatus(meme.Status), nil
+		},
+	})
+}
+
+// memeStatusPoll reads current status of streamed meme every interval.
+type memeStatusPoll struct {
+	interval time.Duration
+	status   func() (string, error)
+}
+
+// streamMemeEvents writes events to client until client disconnects. When
+// initial event is given the stream is single meme stream, it starts with
+// initial event and ends with first final status. Single meme streams may
+// be polled, statuses differing from the last written one are written too.
+func streamMemeEvents(w http.ResponseWriter, r *http.Request, events <-chan MemeEvent, initial *MemeEvent, poll *memeStatusPoll) {
+	ctx := appengine.NewContext(r)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, ErrorCodeStreamingNotSupported, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if initial != nil {
+		if err := writeMemeEvent(w, *initial); err != nil {
+			log.Errorf(ctx, "writing meme event failed, error: %s", err)
+			return
+		}
+		flusher.Flush()
+
+		if isFinalMemeStatus(initial.Status) {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(MemeEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	// nil channel never receives when stream isn't polled
+	var polls <-chan time.Time
+	if poll != nil {
+		pollTicker := time.NewTicker(poll.interval)
+		defer pollTicker.Stop()
+		polls = pollTicker.C
+	}
+
+	var last string
+	if initial != nil {
+		last = initial.Status
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-events:
+			if err := writeMemeEvent(w, e); err != nil {
+				log.Errorf(ctx, "writing meme event failed, error: %s", err)
+				return
+			}
+			flusher.Flush()
+			last = e.Status
+
+			if initial != nil && isFinalMemeStatus(e.Status) {
+				return
+			}
+		case <-polls:
+			status, err := poll.status()
+			if err != nil {
+				log.Errorf(ctx, "reading meme status failed, error: %s", err)
+				continue
+			}
+
+			if status == last {
+				continue
+			}
+
+			if err := writeMemeEvent(w, MemeEvent{
+				MemeID: initial.MemeID,
+				Status: status,
+				Time:   time.Now(),
+			}); err != nil {
+				log.Errorf(ctx, "writing meme event failed, error: %s", err)
+				return
+			}
+			flusher.Flush()
+			last = status
+
+			if isFinalMemeStatus(status) {
+				return
+			}
+		}
+	}
+}
+
+// writeMemeEvent writes single event in Server-Sent Events format.
+func writeMemeEvent(w http.ResponseWriter, e MemeEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Status, data)
+	return err
+}
+
+// isFinalMemeStatus reports whether meme in given status won't change anymore.
+func isFinalMemeStatus(status string) bool {
+	return status == MemeStatusDone || status == MemeStatusFailed
+}
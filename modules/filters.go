@@ -0,0 +1,297 @@
+package memecreator
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"math/rand"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// maxBlurSigma is largest standard deviation blurred at full resolution,
+// larger blurs are done on downscaled image, so their kernel stays small.
+const maxBlurSigma = 4
+
+// Effect changes rendered image. Effects may change image in place or
+// return new image of the same size.
+type Effect func(img *image.NRGBA) *image.NRGBA
+
+// applyEffects applies effects in order to image, images with higher
+// precision are converted to 8 bits first.
+func applyEffects(img draw.Image, effects []Effect) draw.Image {
+	if len(effects) == 0 {
+		return img
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+
+	for _, effect := range effects {
+		nrgba = effect(nrgba)
+	}
+
+	return nrgba
+}
+
+// mapPixels returns effect changing color channels of every pixel by f,
+// alpha is kept.
+func mapPixels(f func(r, g, b float64) (float64, float64, float64)) Effect {
+	return func(img *image.NRGBA) *image.NRGBA {
+		for i := 0; i+3 < len(img.Pix); i += 4 {
+			r, g, b := f(float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2]))
+			img.Pix[i] = clampChannel(r)
+			img.Pix[i+1] = clampChannel(g)
+			img.Pix[i+2] = clampChannel(b)
+		}
+
+		return img
+	}
+}
+
+// clampChannel rounds value to nearest valid 8-bit channel value.
+func clampChannel(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+
+	return uint8(v + 0.5)
+}
+
+// luma returns Rec. 601 luma of color channels.
+func luma(r, g, b float64) float64 {
+	return 0.299*r + 0.587*g + 0.114*b
+}
+
+// Grayscale returns effect mixing image with its grayscale version, amount 1
+// is fully gray.
+func Grayscale(amount float64) Effect {
+	return mapPixels(func(r, g, b float64) (float64, float64, float64) {
+		y := luma(r, g, b)
+		return r + (y-r)*amount, g + (y-g)*amount, b + (y-b)*amount
+	})
+}
+
+// Sepia returns effect mixing image with its sepia toned version, amount 1
+// is fully toned.
+func Sepia(amount float64) Effect {
+	return mapPixels(func(r, g, b float64) (float64, float64, float64) {
+		sr := 0.393*r + 0.769*g + 0.189*b
+		sg := 0.349*r + 0.686*g + 0.168*b
+		sb := 0.272*r + 0.534*g + 0.131*b
+		return r + (sr-r)*amount, g + (sg-g)*amount, b + (sb-b)*amount
+	})
+}
+
+// Saturation returns effect scaling distance of colors from gray by factor,
+// factors above 1 boost colors and 0 makes image gray.
+func Saturation(factor float64) Effect {
+	return mapPixels(func(r, g, b float64) (float64, float64, float64) {
+		y := luma(r, g, b)
+		return y + (r-y)*factor, y + (g-y)*factor, y + (b-y)*factor
+	})
+}
+
+// Contrast returns effect scaling distance of channels from middle gray by
+// factor.
+func Contrast(factor float64) Effect {
+	return mapPixels(func(r, g, b float64) (float64, float64, float64) {
+		return (r-128)*factor + 128, (g-128)*factor + 128, (b-128)*factor + 128
+	})
+}
+
+// Noise returns effect adding gaussian noise with standard deviation amount
+// of full channel range to every channel. Noise is generated from seed, so
+// the same image gets the same noise.
+func Noise(amount float64, seed int64) Effect {
+	return func(img *image.NRGBA) *image.NRGBA {
+		rnd := rand.New(rand.NewSource(seed))
+		return mapPixels(func(r, g, b float64) (float64, float64, float64) {
+			return r + rnd.NormFloat64()*amount*255,
+				g + rnd.NormFloat64()*amount*255,
+				b + rnd.NormFloat64()*amount*255
+		})(img)
+	}
+}
+
+// Pixelate returns effect filling blocks of size pixels with their average
+// color.
+func Pixelate(size int) Effect {
+	return func(img *image.NRGBA) *image.NRGBA {
+		if size < 2 {
+			return img
+		}
+
+		bounds := img.Bounds()
+		for by := bounds.Min.Y; by < bounds.Max.Y; by += size {
+			for bx := bounds.Min.X; bx < bounds.Max.X; bx += size {
+				block := image.Rect(bx, by, bx+size, by+size).Intersect(bounds)
+
+				var sum [4]int
+				for y := block.Min.Y; y < block.Max.Y; y++ {
+					for x := block.Min.X; x < block.Max.X; x++ {
+						i := img.PixOffset(x, y)
+						for c := 0; c < 4; c++ {
+							sum[c] += int(img.Pix[i+c])
+						}
+					}
+				}
+
+				n := block.Dx() * block.Dy()
+				for y := block.Min.Y; y < block.Max.Y; y++ {
+					for x := block.Min.X; x < block.Max.X; x++ {
+						i := img.PixOffset(x, y)
+						for c := 0; c < 4; c++ {
+							img.Pix[i+c] = uint8(sum[c] / n)
+						}
+					}
+				}
+			}
+		}
+
+		return img
+	}
+}
+
+// GaussianBlur returns effect blurring image with gaussian kernel of given
+// standard deviation in pixels, edges are extended. Blurs with standard
+// deviation over maxBlurSigma downscale image first, so their cost doesn't
+// grow with it.
+func GaussianBlur(sigma float64) Effect {
+	return func(img *image.NRGBA) *image.NRGBA {
+		if sigma <= 0 {
+			return img
+		}
+
+		if scale := sigma / maxBlurSigma; scale > 1 {
+			bounds := img.Bounds()
+			small := image.NewNRGBA(image.Rect(
+				0,
+				0,
+				int(math.Max(1, math.Ceil(float64(bounds.Dx())/scale))),
+				int(math.Max(1, math.Ceil(float64(bounds.Dy())/scale))),
+			))
+			xdraw.CatmullRom.Scale(small, small.Bounds(), img, bounds, draw.Src, nil)
+			small = GaussianBlur(maxBlurSigma)(small)
+			xdraw.BiLinear.Scale(img, bounds, small, small.Bounds(), draw.Src, nil)
+
+			return img
+		}
+
+		radius := int(math.Ceil(3 * sigma))
+		kernel := make([]float64, 2*radius+1)
+		sum := 0.0
+		for i := range kernel {
+			d := float64(i - radius)
+			kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+			sum += kernel[i]
+		}
+		for i := range kernel {
+			kernel[i] /= sum
+		}
+
+		// kernel is separable, blur rows into temporary image then columns
+		bounds := img.Bounds()
+		tmp := image.NewNRGBA(bounds)
+		blur1D(tmp, img, kernel, 1, 0)
+		blur1D(img, tmp, kernel, 0, 1)
+
+		return img
+	}
+}
+
+// blur1D convolves src with kernel in direction dx, dy into dst.
+func blur1D(dst, src *image.NRGBA, kernel []float64, dx, dy int) {
+	bounds := src.Bounds()
+	radius := len(kernel) / 2
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var acc [4]float64
+			for k, weight := range kernel {
+				sx := x + (k-radius)*dx
+				sy := y + (k-radius)*dy
+				if sx < bounds.Min.X {
+					sx = bounds.Min.X
+				} else if sx >= bounds.Max.X {
+					sx = bounds.Max.X - 1
+				}
+				if sy < bounds.Min.Y {
+					sy = bounds.Min.Y
+				} else if sy >= bounds.Max.Y {
+					sy = bounds.Max.Y - 1
+				}
+
+				i := src.PixOffset(sx, sy)
+				for c := 0; c < 4; c++ {
+					acc[c] += float64(src.Pix[i+c]) * weight
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = clampChannel(acc[c])
+			}
+		}
+	}
+}
+
+// JPEGCrush returns effect encoding and decoding image as JPEG of given
+// quality repeatedly, adding compression artifacts of every pass.
+func JPEGCrush(quality, passes int) Effect {
+	return func(img *image.NRGBA) *image.NRGBA {
+		var buf bytes.Buffer
+		for i := 0; i < passes; i++ {
+			buf.Reset()
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+				return img
+			}
+
+			decoded, err := jpeg.Decode(&buf)
+			if err != nil {
+				return img
+			}
+
+			crushed := image.NewNRGBA(img.Bounds())
+			draw.Draw(crushed, crushed.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+			img = crushed
+		}
+
+		return img
+	}
+}
+
+// DeepFry returns preset oversaturating image, boosting contrast, adding
+// noise and crushing it with repeated low quality JPEG compression.
+// Intensity 1 is the usual deep-fried look.
+func DeepFry(intensity float64, seed int64) Effect {
+	quality := int(12 / math.Max(intensity, 0.1))
+	if quality < 1 {
+		quality = 1
+	} else if quality > 50 {
+		quality = 50
+	}
+
+	effects := []Effect{
+		Saturation(1 + 2*intensity),
+		Contrast(1 + 0.6*intensity),
+		Noise(0.04*intensity, seed),
+		JPEGCrush(quality, 3),
+	}
+
+	return func(img *image.NRGBA) *image.NRGBA {
+		for _, effect := range effects {
+			img = effect(img)
+		}
+
+		return img
+	}
+}
@@ -0,0 +1,247 @@
+package memecreator
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/gofont/gosmallcaps"
+)
+
+const (
+	// DefaultFontID is id of font embedded in WorkerFontBytes.
+	DefaultFontID = "default"
+
+	// maxParsedFonts is maximum number of fonts kept by RenderMeme cache.
+	maxParsedFonts = 16
+
+	// maxFacePools is maximum number of distinct face settings kept in cache.
+	maxFacePools = 256
+)
+
+// Fonts is registry of fonts available for rendering memes.
+var Fonts = NewFontRegistry()
+
+// builtinFonts are fonts compiled into binary, they are always available.
+var builtinFonts = map[string][]byte{
+	DefaultFontID:  WorkerFontBytes,
+	"go-regular":   goregular.TTF,
+	"go-medium":    gomedium.TTF,
+	"go-bold":      gobold.TTF,
+	"go-mono":      gomono.TTF,
+	"go-smallcaps": gosmallcaps.TTF,
+}
+
+func init() {
+	for id, fontBytes := range builtinFonts {
+		if _, err := Fonts.Register(id, fontBytes); err != nil {
+			panic(fmt.Sprintf("parsing builtin font %s failed, error: %s", id, err))
+		}
+	}
+}
+
+// isBuiltinFont reports whether font with given id is compiled into binary.
+func isBuiltinFont(id string) bool {
+	_, ok := builtinFonts[id]
+	return ok
+}
+
+// FontRegistry is thread-safe registry of parsed fonts keyed by font id.
+// Parsed fonts are read-only and can be shared by any number of renderers.
+type FontRegistry struct {
+	mu    sync.RWMutex
+	fonts map[string]registeredFont
+}
+
+// registeredFont is parsed font with version of its bytes. Version is
+// creation time of uploaded font, it is zero for builtin fonts.
+type registeredFont struct {
+	font    *truetype.Font
+	version time.Time
+}
+
+// NewFontRegistry creates new empty registry.
+func NewFontRegistry() *FontRegistry {
+	return &FontRegistry{
+		fonts: make(map[string]registeredFont),
+	}
+}
+
+// Register parses font and stores it under given id, existing font with the
+// same id is replaced.
+func (fr *FontRegistry) Register(id string, fontBytes []byte) (*truetype.Font, error) {
+	return fr.RegisterVersion(id, fontBytes, time.Time{})
+}
+
+// RegisterVersion is like Register, but it also records version of font
+// bytes, so font replaced by newer upload can be detected.
+func (fr *FontRegistry) RegisterVersion(id string, fontBytes []byte, version time.Time) (*truetype.Font, error) {
+	f, err := truetype.Parse(fontBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fr.mu.Lock()
+	fr.fonts[id] = registeredFont{font: f, version: version}
+	fr.mu.Unlock()
+
+	return f, nil
+}
+
+// Font returns parsed font with given id.
+func (fr *FontRegistry) Font(id string) (*truetype.Font, bool) {
+	fr.mu.RLock()
+	rf, ok := fr.fonts[id]
+	fr.mu.RUnlock()
+
+	return rf.font, ok
+}
+
+// Version returns version of font registered with given id.
+func (fr *FontRegistry) Version(id string) (time.Time, bool) {
+	fr.mu.RLock()
+	rf, ok := fr.fonts[id]
+	fr.mu.RUnlock()
+
+	return rf.version, ok
+}
+
+// IDs returns sorted ids of all registered fonts.
+func (fr *FontRegistry) IDs() []string {
+	fr.mu.RLock()
+	ids := make([]string, 0, len(fr.fonts))
+	for id := range fr.fonts {
+		ids = append(ids, id)
+	}
+	fr.mu.RUnlock()
+
+	sort.Strings(ids)
+	return ids
+}
+
+// parsedFontKey identifies font bytes by SHA-256 of their content, so
+// reused buffers don't return stale fonts and cache doesn't keep callers'
+// buffers alive.
+type parsedFontKey [sha256.Size]byte
+
+var parsedFonts = struct {
+	sync.Mutex
+	fonts map[parsedFontKey]*truetype.Font
+}{
+	fonts: make(map[parsedFontKey]*truetype.Font),
+}
+
+// parseFontCached parses font bytes once and returns the same font for every
+// following call with the same content.
+func parseFontCached(fontBytes []byte) (*truetype.Font, error) {
+	if len(fontBytes) == 0 {
+		return truetype.Parse(fontBytes)
+	}
+
+	// hashing is done before locking, so concurrent renders don't wait on it
+	key := parsedFontKey(sha256.Sum256(fontBytes))
+
+	parsedFonts.Lock()
+	defer parsedFonts.Unlock()
+
+	if f, ok := parsedFonts.fonts[key]; ok {
+		return f, nil
+	}
+
+	f, err := truetype.Parse(fontBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsedFonts.fonts) >= maxParsedFonts {
+		parsedFonts.fonts = make(map[parsedFontKey]*truetype.Font)
+	}
+	parsedFonts.fonts[key] = f
+
+	return f, nil
+}
+
+// faceKey identifies face settings.
+type faceKey struct {
+	font    *truetype.Font
+	size    float64
+	dpi     float64
+	hinting font.Hinting
+}
+
+// faceCache pools faces by their settings. Faces are not safe for concurrent
+// use, so every render acquires its own face, but glyphs cached in face stay
+// warm for following renders. When cache is full, least recently used
+// settings are evicted.
+var faceCache = struct {
+	sync.Mutex
+	pools map[faceKey]*list.Element
+	lru   *list.List // of *facePool, most recently used first
+}{
+	pools: make(map[faceKey]*list.Element),
+	lru:   list.New(),
+}
+
+// facePool pools faces of single settings.
+type facePool struct {
+	key  faceKey
+	pool *sync.Pool
+}
+
+// acquireFace returns face for font with given settings and function which
+// returns face back to cache once caller is done with it. It is meant for
+// drawing at final font size, use measureFace while searching for size.
+func acquireFace(f *truetype.Font, size, dpi float64, hinting font.Hinting) (font.Face, func()) {
+	key := faceKey{font: f, size: size, dpi: dpi, hinting: hinting}
+
+	faceCache.Lock()
+	var pool *sync.Pool
+	if e, ok := faceCache.pools[key]; ok {
+		faceCache.lru.MoveToFront(e)
+		pool = e.Value.(*facePool).pool
+	} else {
+		if faceCache.lru.Len() >= maxFacePools {
+			oldest := faceCache.lru.Back()
+			faceCache.lru.Remove(oldest)
+			delete(faceCache.pools, oldest.Value.(*facePool).key)
+		}
+
+		pool = &sync.Pool{
+			New: func() interface{} {
+				return truetype.NewFace(f, &truetype.Options{
+					Size:    size,
+					DPI:     dpi,
+					Hinting: hinting,
+				})
+			},
+		}
+		faceCache.pools[key] = faceCache.lru.PushFront(&facePool{key: key, pool: pool})
+	}
+	faceCache.Unlock()
+
+	face := pool.Get().(font.Face)
+	return face, func() {
+		pool.Put(face)
+	}
+}
+
+// measureFace returns uncached face for measuring text and reading metrics.
+// Advances and metrics don't use glyph cache, so candidate sizes tried while
+// fitting text don't need to be pooled.
+func measureFace(f *truetype.Font, size, dpi float64, hinting font.Hinting) font.Face {
+	return truetype.NewFace(f, &truetype.Options{
+		Size:              size,
+		DPI:               dpi,
+		Hinting:           hinting,
+		GlyphCacheEntries: 1,
+	})
+}
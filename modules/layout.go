@@ -0,0 +1,291 @@
+package memecreator
+
+import (
+	"image"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+const (
+	// fontSizeStep is precision of fitted font size in points, fitted sizes
+	// are rounded down to it so pooled faces are shared between captions.
+	fontSizeStep = 0.5
+
+	// maxBandLines is number of lines band captions are wrapped into before
+	// their font size is reduced.
+	maxBandLines = 3
+)
+
+// captionLayout is computed size and position of single caption line.
+type captionLayout struct {
+	runs    []textRun
+	style   TextStyle
+	size    float64
+	width   fixed.Int26_6
+	dot     fixed.Point26_6
+	metrics font.Metrics
+}
+
+// bounds returns box covered by caption line from its ascent to descent.
+func (l *captionLayout) bounds() image.Rectangle {
+	return image.Rect(
+		l.dot.X.Floor(),
+		(l.dot.Y - l.metrics.Ascent).Floor(),
+		(l.dot.X + l.width).Ceil(),
+		(l.dot.Y + l.metrics.Descent).Ceil(),
+	)
+}
+
+// measureRuns returns width of runs drawn at given size with letter spacing
+// in ems. Kerning is applied between glyphs of the same run, runs of
+// different fonts are not kerned.
+func (r *Renderer) measureRuns(runs []textRun, size, spacing float64) fixed.Int26_6 {
+	tracking := r.tracking(size, spacing)
+
+	width, glyphs := fixed.Int26_6(0), 0
+	for _, run := range runs {
+		runSize := run.fontSize(size)
+		if run.bitmap != nil {
+			width += r.bitmapAdvance(run.bitmap, runSize)
+			glyphs++
+			continue
+		}
+
+		face := measureFace(run.font, runSize, r.opts.DPI, r.opts.Hinting)
+		width += font.MeasureString(face, run.text)
+		glyphs += utf8.RuneCountInString(run.text)
+	}
+
+	// tracking goes between glyphs, not after the last one
+	if glyphs > 1 {
+		width += tracking * fixed.Int26_6(glyphs-1)
+	}
+
+	return width
+}
+
+// tracking returns letter spacing in ems converted to pixels at font size.
+func (r *Renderer) tracking(size, spacing float64) fixed.Int26_6 {
+	return fixed.Int26_6(spacing * size * r.opts.DPI / 72 * 64)
+}
+
+// bitmapAdvance returns advance of bitmap glyph scaled to font size.
+func (r *Renderer) bitmapAdvance(glyph image.Image, size float64) fixed.Int26_6 {
+	height := int(size * r.opts.DPI / 72)
+	bounds := glyph.Bounds()
+	if height <= 0 || bounds.Dy() == 0 {
+		return 0
+	}
+
+	return fixed.I(bounds.Dx() * height / bounds.Dy())
+}
+
+// fitFontSize returns the largest font size within renderer size range at
+// which runs fit into width, together with text width at that size. Text
+// not fitting even at minimum size is returned at minimum size.
+func (r *Renderer) fitFontSize(runs []textRun, width int, spacing float64) (float64, fixed.Int26_6) {
+	maxSize, minSize := r.opts.MaxFontSize, r.opts.MinFontSize
+	limit := fixed.I(width)
+
+	textWidth := r.measureRuns(runs, maxSize, spacing)
+	if textWidth <= limit {
+		return maxSize, textWidth
+	}
+
+	// text width grows linearly with size apart from hinting and rounding,
+	// so estimate size from width at maximum size and shrink until it fits
+	size := math.Floor(maxSize*float64(limit)/float64(textWidth)/fontSizeStep) * fontSizeStep
+	for ; size > minSize; size -= fontSizeStep {
+		textWidth = r.measureRuns(runs, size, spacing)
+		if textWidth <= limit {
+			return size, textWidth
+		}
+	}
+
+	return minSize, r.measureRuns(runs, minSize, spacing)
+}
+
+// layoutCaption transforms caption text, fits it into width starting at
+// left edge and aligns it. Baseline is computed from face metrics by
+// baseline function.
+func (r *Renderer) layoutCaption(c Caption, left, width int, baseline func(m font.Metrics) fixed.Int26_6) *captionLayout {
+	style := r.captionStyle(c)
+
+	text, smallCaps := transformText(c.Text, style.Transform, style.Language)
+	runs := r.textRuns(r.visualLine(text), smallCaps)
+	size, textWidth := r.fitFontSize(runs, width, style.LetterSpacing)
+
+	return r.alignLine(text, runs, style, size, textWidth, left, width, baseline)
+}
+
+// layoutBand wraps caption into lines fitting width starting at left edge
+// and lays them out below each other from top of band. Font size is the
+// largest one at which caption fits into maxBandLines lines. Returned height
+// of band includes top and bottom margins, empty captions have no band.
+func (r *Renderer) layoutBand(c Caption, left, width, top int) ([]*captionLayout, int) {
+	if strings.TrimSpace(c.Text) == "" {
+		return nil, 0
+	}
+
+	style := r.captionStyle(c)
+	text, smallCaps := transformText(c.Text, style.Transform, style.Language)
+
+	size := r.opts.MaxFontSize
+	lines := r.wrapLines(text, size, style.LetterSpacing, width, smallCaps)
+	for len(lines) > maxBandLines && size > r.opts.MinFontSize {
+		size = math.Max(size-fontSizeStep, r.opts.MinFontSize)
+		lines = r.wrapLines(text, size, style.LetterSpacing, width, smallCaps)
+	}
+
+	metrics := measureFace(r.opts.Fonts[0], size, r.opts.DPI, r.opts.Hinting).Metrics()
+
+	layouts := make([]*captionLayout, len(lines))
+	for i, line := range lines {
+		runs := r.textRuns(r.visualLine(line), smallCaps)
+		textWidth := r.measureRuns(runs, size, style.LetterSpacing)
+
+		lineTop := fixed.I(top+r.opts.Margins.Top) + metrics.Height*fixed.Int26_6(i)
+		layouts[i] = r.alignLine(line, runs, style, size, textWidth, left, width, func(m font.Metrics) fixed.Int26_6 {
+			return lineTop + m.Ascent
+		})
+	}
+
+	height := r.opts.Margins.Top + (metrics.Height * fixed.Int26_6(len(lines))).Ceil() + r.opts.Margins.Bottom
+	return layouts, height
+}
+
+// layoutBox wraps caption into lines fitting box of given size at its
+// origin and centers them vertically. Font size is the largest one at which
+// all lines fit into box, captions not fitting at minimum size overflow it.
+func (r *Renderer) layoutBox(c Caption, width, height int) []*captionLayout {
+	if strings.TrimSpace(c.Text) == "" {
+		return nil
+	}
+
+	style := r.captionStyle(c)
+	text, smallCaps := transformText(c.Text, style.Transform, style.Language)
+
+	size := r.opts.MaxFontSize
+	var lines []string
+	var metrics font.Metrics
+	for {
+		lines = r.wrapLines(text, size, style.LetterSpacing, width, smallCaps)
+
+		metrics = measureFace(r.opts.Fonts[0], size, r.opts.DPI, r.opts.Hinting).Metrics()
+
+		fits := metrics.Height*fixed.Int26_6(len(lines)) <= fixed.I(height)
+		for _, line := range lines {
+			runs := r.textRuns(r.visualLine(line), smallCaps)
+			fits = fits && r.measureRuns(runs, size, style.LetterSpacing) <= fixed.I(width)
+		}
+
+		if fits || size <= r.opts.MinFontSize {
+			break
+		}
+		size = math.Max(size-fontSizeStep, r.opts.MinFontSize)
+	}
+
+	top := (fixed.I(height) - metrics.Height*fixed.Int26_6(len(lines))) / 2
+
+	layouts := make([]*captionLayout, len(lines))
+	for i, line := range lines {
+		runs := r.textRuns(r.visualLine(line), smallCaps)
+		textWidth := r.measureRuns(runs, size, style.LetterSpacing)
+
+		lineTop := top + metrics.Height*fixed.Int26_6(i)
+		layouts[i] = r.alignLine(line, runs, style, size, textWidth, 0, width, func(m font.Metrics) fixed.Int26_6 {
+			return lineTop + m.Ascent
+		})
+	}
+
+	return layouts
+}
+
+// wrapLines splits text into lines of whole words fitting width at size,
+// words longer than width are left on their own line.
+func (r *Renderer) wrapLines(text string, size, spacing float64, width int, smallCaps *cases.Caser) []string {
+	var lines []string
+
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+
+		runs := r.textRuns(r.visualLine(candidate), smallCaps)
+		if line == "" || r.measureRuns(runs, size, spacing) <= fixed.I(width) {
+			line = candidate
+			continue
+		}
+
+		lines = append(lines, line)
+		line = word
+	}
+
+	return append(lines, line)
+}
+
+// captionStyle returns style of caption with missing color taken from
+// renderer style.
+func (r *Renderer) captionStyle(c Caption) TextStyle {
+	style := c.Style
+	if style.Color == nil {
+		style.Color = r.opts.Style.Color
+	}
+
+	return style
+}
+
+// alignLine positions line of runs of given width and size horizontally in
+// width starting at left edge.
+func (r *Renderer) alignLine(text string, runs []textRun, style TextStyle, size float64, textWidth fixed.Int26_6, left, width int, baseline func(m font.Metrics) fixed.Int26_6) *captionLayout {
+	x := fixed.I(left) + (fixed.I(width)-textWidth)/2
+	switch style.Align {
+	case AlignAuto:
+		if isRTLDominant(text) {
+			x = fixed.I(left+width) - textWidth
+		}
+	case AlignLeft:
+		x = fixed.I(left)
+	case AlignRight:
+		x = fixed.I(left+width) - textWidth
+	}
+
+	metrics := measureFace(r.opts.Fonts[0], size, r.opts.DPI, r.opts.Hinting).Metrics()
+
+	return &captionLayout{
+		runs:  runs,
+		style: style,
+		size:  size,
+		width: textWidth,
+		dot: fixed.Point26_6{
+			X: x,
+			Y: baseline(metrics),
+		},
+		metrics: metrics,
+	}
+}
+
+// transformText changes case of text using casing rules of language. Small
+// caps keep text as it is and return caser upper casing lower case letters
+// while splitting text into runs.
+func transformText(text string, transform TextTransform, lang language.Tag) (string, *cases.Caser) {
+	switch transform {
+	case TransformUppercase:
+		return cases.Upper(lang).String(text), nil
+	case TransformTitle:
+		return cases.Title(lang).String(text), nil
+	case TransformSmallCaps:
+		caser := cases.Upper(lang)
+		return text, &caser
+	}
+
+	return text, nil
+}
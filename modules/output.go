@@ -0,0 +1,183 @@
+package memecreator
+
+import (
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// DefaultJPEGQuality is quality of JPEG memes without quality set.
+	DefaultJPEGQuality = 90
+
+	// MaxPaletteColors is maximum and default number of colors of
+	// palette-quantized PNG memes.
+	MaxPaletteColors = 256
+)
+
+const (
+	// FormatPNG is lossless full color PNG, it is default format of memes.
+	FormatPNG = "png"
+
+	// FormatJPEG is lossy JPEG suitable for photo templates.
+	FormatJPEG = "jpeg"
+
+	// FormatPalettedPNG is PNG with palette of up to 256 colors.
+	FormatPalettedPNG = "png8"
+
+	// FormatSVG is SVG with embedded template and captions as text, it has
+	// no resized variants.
+	FormatSVG = "svg"
+)
+
+// pngCompressionLevels maps compression names used in API to PNG levels.
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// OutputFormat is type used for storing format of rendered meme. Quality
+// applies to JPEG, compression and colors to PNG formats.
+type OutputFormat struct {
+	Format      string `json:"format,omitempty"`
+	Quality     int    `json:"quality,omitempty"`
+	Compression string `json:"compression,omitempty"`
+	Colors      int    `json:"colors,omitempty"`
+}
+
+// encoder returns renderer encoder writing memes in format.
+func (o OutputFormat) encoder() Encoder {
+	level := pngCompressionLevels[o.Compression]
+
+	switch o.Format {
+	case FormatJPEG:
+		quality := o.Quality
+		if quality == 0 {
+			quality = DefaultJPEGQuality
+		}
+		return JPEGEncoder(quality)
+	case FormatPalettedPNG:
+		colors := o.Colors
+		if colors == 0 {
+			colors = MaxPaletteColors
+		}
+		return PalettedPNGEncoder(colors, level)
+	}
+
+	return PNGLevelEncoder(level)
+}
+
+// extension returns file extension of format.
+func (o OutputFormat) extension() string {
+	switch o.Format {
+	case FormatJPEG:
+		return "jpg"
+	case FormatSVG:
+		return "svg"
+	}
+
+	return "png"
+}
+
+// contentType returns media type of format.
+func (o OutputFormat) contentType() string {
+	switch o.Format {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatSVG:
+		return "image/svg+xml"
+	}
+
+	return "image/png"
+}
+
+// objectName returns name of cloud storage object with rendered meme.
+func (o OutputFormat) objectName(memeID string) string {
+	return memeID + "." + o.extension()
+}
+
+// outputFormatFromForm creates output format from form values.
+func outputFormatFromForm(form url.Values) (OutputFormat, error) {
+	o := OutputFormat{
+		Format:      form.Get("format"),
+		Compression: form.Get("compression"),
+	}
+
+	for _, field := range []struct {
+		name string
+		dst  *int
+	}{
+		{"quality", &o.Quality},
+		{"colors", &o.Colors},
+	} {
+		v := form.Get(field.name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return o, fmt.Errorf("parsing %s failed, error: %s", field.name, err)
+		}
+		*field.dst = n
+	}
+
+	return o, nil
+}
+
+// formatFromQuery sets output format of commands to format query parameter
+// when it is present, e.g. ?format=svg, overriding format in request body.
+func formatFromQuery(r *http.Request, cmds ...*CreateMemeCommand) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return
+	}
+
+	for _, cmd := range cmds {
+		if cmd != nil {
+			cmd.Output.Format = format
+		}
+	}
+}
+
+// validateOutputFormat checks that output format is known and its settings
+// are within limits.
+func validateOutputFormat(o OutputFormat) []*ValidationError {
+	var errs []*ValidationError
+
+	switch o.Format {
+	case "", FormatPNG, FormatJPEG, FormatPalettedPNG, FormatSVG:
+	default:
+		errs = append(errs, &ValidationError{
+			Field:   "output.format",
+			Message: "format must be one of png, jpeg, png8 or svg",
+		})
+	}
+
+	if o.Quality < 0 || o.Quality > 100 {
+		errs = append(errs, &ValidationError{
+			Field:   "output.quality",
+			Message: "quality must be between 1 and 100",
+		})
+	}
+
+	if _, ok := pngCompressionLevels[o.Compression]; o.Compression != "" && !ok {
+		errs = append(errs, &ValidationError{
+			Field:   "output.compression",
+			Message: "compression must be one of default, none, speed or best",
+		})
+	}
+
+	if o.Colors != 0 && (o.Colors < 2 || o.Colors > MaxPaletteColors) {
+		errs = append(errs, &ValidationError{
+			Field:   "output.colors",
+			Message: fmt.Sprintf("colors must be between 2 and %d", MaxPaletteColors),
+		})
+	}
+
+	return errs
+}
@@ -0,0 +1,297 @@
+package memecreator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+const (
+	// MasterObjectPrefix is prefix of cloud storage objects with normalized
+	// template masters.
+	MasterObjectPrefix = "masters/"
+
+	// masterJPEGQuality is quality of JPEG masters, high enough to not lose
+	// visible detail on second encoding.
+	masterJPEGQuality = 95
+
+	// MaxTemplatePixels is maximum number of pixels of template image, larger
+	// images are rejected before they are decoded.
+	MaxTemplatePixels = 50 * 1000 * 1000
+)
+
+var (
+	// errUnsupportedImage is returned when template file is not an image.
+	errUnsupportedImage = errors.New("template file is not supported image")
+
+	// errTemplateTooLarge is returned when template has too many pixels.
+	errTemplateTooLarge = fmt.Errorf("template can have at most %d megapixels", MaxTemplatePixels/1000/1000)
+
+	// errCropOutside is returned when crop rectangle is not within template.
+	errCropOutside = errors.New("crop rectangle is outside of template")
+)
+
+// TemplateOptions are settings of template normalization. Zero values keep
+// template as it is.
+type TemplateOptions struct {
+	// MaxDimension limits width and height of master, larger templates
+	// are scaled down keeping aspect ratio.
+	MaxDimension int
+
+	// Crop is applied after orientation, in coordinates of upright image.
+	Crop image.Rectangle
+}
+
+// templateOptionsFromForm creates template options from max_dimension and
+// crop form fields, crop is given as x,y,width,height.
+func templateOptionsFromForm(form url.Values) (TemplateOptions, error) {
+	var opts TemplateOptions
+
+	if v := form.Get("max_dimension"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("parsing max dimension failed, error: %s", err)
+		}
+		opts.MaxDimension = n
+	}
+
+	if v := form.Get("crop"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return opts, fmt.Errorf("crop must have 4 values, got %d", len(parts))
+		}
+
+		var n [4]int
+		for i, p := range parts {
+			var err error
+			if n[i], err = strconv.Atoi(strings.TrimSpace(p)); err != nil {
+				return opts, fmt.Errorf("parsing crop failed, error: %s", err)
+			}
+		}
+		opts.Crop = image.Rect(n[0], n[1], n[0]+n[2], n[1]+n[3])
+	}
+
+	return opts, nil
+}
+
+// validateTemplateOptions checks that template options are within limits.
+func validateTemplateOptions(opts TemplateOptions) []*ValidationError {
+	var errs []*ValidationError
+
+	if opts.MaxDimension < 0 {
+		errs = append(errs, &ValidationError{
+			Field:   "max_dimension",
+			Message: "max dimension must be positive",
+		})
+	}
+
+	if opts.Crop != (image.Rectangle{}) && (opts.Crop.Min.X < 0 || opts.Crop.Min.Y < 0 || opts.Crop.Empty()) {
+		errs = append(errs, &ValidationError{
+			Field:   "crop",
+			Message: "crop must have non-negative position and positive size",
+		})
+	}
+
+	return errs
+}
+
+// normalizeTemplate decodes template, applies its EXIF orientation, crop
+// and maximum dimension and returns upright master image with its format.
+// Master is encoded again, so no metadata of original file is kept.
+func normalizeTemplate(data []byte, opts TemplateOptions) (image.Image, string, error) {
+	// dimensions are checked first, so small files declaring huge images
+	// don't exhaust memory when decoded
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errUnsupportedImage
+	}
+
+	if int64(config.Width)*int64(config.Height) > MaxTemplatePixels {
+		return nil, "", errTemplateTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", errUnsupportedImage
+	}
+
+	if format == "jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	if opts.Crop != (image.Rectangle{}) {
+		crop := opts.Crop.Add(img.Bounds().Min)
+		if !crop.In(img.Bounds()) {
+			return nil, "", errCropOutside
+		}
+
+		cropped := newCanvas(image.Rect(0, 0, crop.Dx(), crop.Dy()), isHighPrecision(img))
+		draw.Draw(cropped, cropped.Bounds(), img, crop.Min, draw.Src)
+		img = cropped
+	}
+
+	bounds := img.Bounds()
+	if max := opts.MaxDimension; max > 0 && (bounds.Dx() > max || bounds.Dy() > max) {
+		width, height := max, bounds.Dy()*max/bounds.Dx()
+		if bounds.Dy() > bounds.Dx() {
+			width, height = bounds.Dx()*max/bounds.Dy(), max
+		}
+
+		scaled := newCanvas(image.Rect(0, 0, width, height), isHighPrecision(img))
+		xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+		img = scaled
+	}
+
+	return img, format, nil
+}
+
+// encodeMaster writes master in JPEG for JPEG templates and PNG for others
+// and returns extension of written file.
+func encodeMaster(w io.Writer, img image.Image, format string) (string, error) {
+	if format == "jpeg" {
+		return "jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: masterJPEGQuality})
+	}
+
+	return "png", png.Encode(w, img)
+}
+
+// exifOrientation returns EXIF orientation of JPEG data from 1 to 8, data
+// without orientation are reported as upright 1.
+func exifOrientation(data []byte) int {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// walk segments until APP1 with EXIF, image data start at SOS
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// tiffOrientation returns orientation tag of first IFD of TIFF structure.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		// orientation is single SHORT stored in value field
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
+
+// orient transforms image stored with EXIF orientation to upright image.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	highPrecision := isHighPrecision(img)
+
+	src := newCanvas(image.Rect(0, 0, w, h), highPrecision)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	// orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := newCanvas(image.Rect(0, 0, dw, dh), highPrecision)
+
+	srcPix, srcStride, bpp := canvasPixels(src)
+	dstPix, dstStride, _ := canvasPixels(dst)
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+
+			copy(dstPix[y*dstStride+x*bpp:], srcPix[sy*srcStride+sx*bpp:sy*srcStride+sx*bpp+bpp])
+		}
+	}
+
+	return dst
+}
+
+// canvasPixels returns pixel data, stride and bytes per pixel of canvas
+// created by newCanvas.
+func canvasPixels(img draw.Image) ([]byte, int, int) {
+	if img, ok := img.(*image.NRGBA64); ok {
+		return img.Pix, img.Stride, 8
+	}
+
+	nrgba := img.(*image.NRGBA)
+	return nrgba.Pix, nrgba.Stride, 4
+}
@@ -1,70 +1,625 @@
 package memecreator
 
 import (
+	"errors"
 	"image"
+	"image/color"
 	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
 
-	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
+	xdraw "golang.org/x/image/draw"
 	"golang.org/x/image/font"
 	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/language"
 )
 
-// RenderMeme handles creating new meme image with text.
-func RenderMeme(fontBytes []byte, src image.Image, top, bottom string) (draw.Image, error) {
-	srcBounds := src.Bounds()
-	newImage := image.NewNRGBA64(image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy()))
-	draw.Draw(newImage, newImage.Bounds(), src, srcBounds.Min, draw.Src)
-	dst := draw.Image(newImage)
+var (
+	// ErrNoFont is returned when renderer is created without any font.
+	ErrNoFont = errors.New("renderer has no font")
+
+	// ErrFontSizeRange is returned when renderer font size range is empty.
+	ErrFontSizeRange = errors.New("renderer font size range is invalid")
+
+	// ErrEmptyImage is returned when rendering source image without pixels.
+	ErrEmptyImage = errors.New("source image is empty")
+)
+
+// Encoder writes rendered image to writer in some image format.
+type Encoder func(w io.Writer, img image.Image) error
+
+// PNGEncoder encodes rendered image as PNG.
+var PNGEncoder Encoder = png.Encode
+
+// PNGLevelEncoder returns encoder encoding rendered image as PNG with given
+// compression level.
+func PNGLevelEncoder(level png.CompressionLevel) Encoder {
+	enc := &png.Encoder{CompressionLevel: level}
+	return enc.Encode
+}
+
+// PalettedPNGEncoder returns encoder encoding rendered image as PNG with
+// palette of at most given number of colors chosen for the image. Colors
+// are dithered, so photos keep smooth gradients.
+func PalettedPNGEncoder(colors int, level png.CompressionLevel) Encoder {
+	enc := &png.Encoder{CompressionLevel: level}
+	return func(w io.Writer, img image.Image) error {
+		bounds := img.Bounds()
+		paletted := image.NewPaletted(bounds, medianCutPalette(img, colors))
+		draw.FloydSteinberg.Draw(paletted, bounds, img, bounds.Min)
+
+		return enc.Encode(w, paletted)
+	}
+}
+
+// JPEGEncoder returns encoder encoding rendered image as JPEG with given quality.
+func JPEGEncoder(quality int) Encoder {
+	return func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+}
+
+// FontSet is ordered list of fonts used for drawing captions, first font is
+// the primary one and the others are fallbacks for runes it has no glyph for.
+type FontSet []*truetype.Font
+
+// Margins is space in pixels between image edges and captions.
+type Margins struct {
+	Top    int
+	Bottom int
+	Left   int
+	Right  int
+}
+
+// Alignment is horizontal alignment of caption.
+type Alignment int
+
+const (
+	// AlignAuto centers captions, right-to-left dominant captions are
+	// aligned right.
+	AlignAuto Alignment = iota
+
+	// AlignCenter centers captions.
+	AlignCenter
+
+	// AlignLeft aligns captions to left margin.
+	AlignLeft
+
+	// AlignRight aligns captions to right margin.
+	AlignRight
+)
+
+// LayoutMode is placement of captions relative to template.
+type LayoutMode int
+
+const (
+	// LayoutOverlay draws captions over top and bottom edge of template.
+	LayoutOverlay LayoutMode = iota
+
+	// LayoutBands draws wrapped captions in bands added above and below
+	// template, growing the image.
+	LayoutBands
+)
+
+// TextTransform is change of letter case applied to caption before drawing.
+type TextTransform int
+
+const (
+	// TransformNone draws captions as typed.
+	TransformNone TextTransform = iota
+
+	// TransformUppercase draws captions in upper case.
+	TransformUppercase
+
+	// TransformTitle draws first letter of every word in upper case.
+	TransformTitle
+
+	// TransformSmallCaps draws lower case letters as smaller capitals.
+	TransformSmallCaps
+)
+
+// TextStyle describes how captions are drawn.
+type TextStyle struct {
+	Color        color.Color
+	OutlineColor color.Color
+	OutlineWidth int
+	Align        Alignment
+
+	// AutoColor picks black or white fill with opposite outline by
+	// luminance of template under caption, Color and OutlineColor are
+	// ignored. Outline is made wider on busy backgrounds.
+	AutoColor bool
+
+	// Transform is applied with casing rules of Language, e.g. Turkish
+	// dotted and dotless i.
+	Transform TextTransform
+	Language  language.Tag
+
+	// LetterSpacing is space added between glyphs in ems, negative values
+	// tighten captions.
+	LetterSpacing float64
+}
+
+// Caption is single caption text drawn with its own style.
+type Caption struct {
+	Text  string
+	Style TextStyle
+}
+
+// RenderOptions is type holding all renderer settings.
+type RenderOptions struct {
+	Fonts   FontSet
+	Bitmaps BitmapFallback
+	DPI     float64
+	Margins Margins
+	Hinting font.Hinting
+	Style   TextStyle
+
+	// Overlays are composited over template before effects and captions.
+	Overlays []Overlay
+
+	// TextBoxes are drawn over template after pre-effects, before top and
+	// bottom captions.
+	TextBoxes []TextBox
+
+	// PreEffects are applied to template before captions are drawn,
+	// PostEffects to the whole meme.
+	PreEffects  []Effect
+	PostEffects []Effect
+
+	// Layout places captions, with LayoutBands bands are filled with
+	// BandColor.
+	Layout    LayoutMode
+	BandColor color.Color
+
+	// MinFontSize and MaxFontSize in points limit size captions are fitted
+	// to, captions not fitting at minimum size overflow image edges.
+	MinFontSize float64
+	MaxFontSize float64
+
+	// Width and Height of output image, when only one is set the other one
+	// keeps aspect ratio of template, zero values keep template size.
+	Width  int
+	Height int
+
+	Encoder Encoder
+}
+
+// RenderOption changes single renderer setting.
+type RenderOption func(*RenderOptions)
+
+// WithFonts sets fonts used for drawing captions.
+func WithFonts(fonts ...*truetype.Font) RenderOption {
+	return func(o *RenderOptions) {
+		o.Fonts = fonts
+	}
+}
+
+// WithBitmapFallback sets bitmap glyphs used for runes missing in all fonts.
+func WithBitmapFallback(b BitmapFallback) RenderOption {
+	return func(o *RenderOptions) {
+		o.Bitmaps = b
+	}
+}
+
+// WithDPI sets resolution used for converting font size to pixels.
+func WithDPI(dpi float64) RenderOption {
+	return func(o *RenderOptions) {
+		o.DPI = dpi
+	}
+}
+
+// WithMargins sets space between image edges and captions.
+func WithMargins(m Margins) RenderOption {
+	return func(o *RenderOptions) {
+		o.Margins = m
+	}
+}
+
+// WithHinting sets font hinting.
+func WithHinting(h font.Hinting) RenderOption {
+	return func(o *RenderOptions) {
+		o.Hinting = h
+	}
+}
+
+// WithFontSizeRange sets range of font sizes captions are fitted to.
+func WithFontSizeRange(min, max float64) RenderOption {
+	return func(o *RenderOptions) {
+		o.MinFontSize = min
+		o.MaxFontSize = max
+	}
+}
+
+// WithTextStyle sets style of captions.
+func WithTextStyle(s TextStyle) RenderOption {
+	return func(o *RenderOptions) {
+		o.Style = s
+	}
+}
+
+// WithLayout sets placement of captions.
+func WithLayout(l LayoutMode) RenderOption {
+	return func(o *RenderOptions) {
+		o.Layout = l
+	}
+}
+
+// WithBandColor sets color of caption bands.
+func WithBandColor(c color.Color) RenderOption {
+	return func(o *RenderOptions) {
+		o.BandColor = c
+	}
+}
+
+// WithEffects sets effects applied to template before captions are drawn
+// and effects applied to the whole meme.
+func WithEffects(pre, post []Effect) RenderOption {
+	return func(o *RenderOptions) {
+		o.PreEffects = pre
+		o.PostEffects = post
+	}
+}
+
+// WithOutputSize sets size of output image.
+func WithOutputSize(width, height int) RenderOption {
+	return func(o *RenderOptions) {
+		o.Width = width
+		o.Height = height
+	}
+}
+
+// WithEncoder sets encoder used by RenderTo.
+func WithEncoder(enc Encoder) RenderOption {
+	return func(o *RenderOptions) {
+		o.Encoder = enc
+	}
+}
+
+// DefaultRenderOptions returns settings used when no option is given.
+func DefaultRenderOptions() RenderOptions {
+	return RenderOptions{
+		DPI: 72,
+		Margins: Margins{
+			Top:    15,
+			Bottom: 15,
+		},
+		Hinting:     font.HintingNone,
+		MinFontSize: 12,
+		MaxFontSize: 72,
+		Style: TextStyle{
+			Color: color.White,
+		},
+		BandColor: color.White,
+		Encoder:   PNGEncoder,
+	}
+}
+
+// Renderer draws captions on templates.
+type Renderer struct {
+	opts RenderOptions
+}
+
+// NewRenderer creates renderer with default settings changed by given options.
+func NewRenderer(opts ...RenderOption) (*Renderer, error) {
+	o := DefaultRenderOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(o.Fonts) == 0 || o.Fonts[0] == nil {
+		return nil, ErrNoFont
+	}
 
-	f, err := freetype.ParseFont(fontBytes)
+	if o.MaxFontSize <= 0 || o.MinFontSize <= 0 || o.MinFontSize > o.MaxFontSize {
+		return nil, ErrFontSizeRange
+	}
+
+	if o.Style.Color == nil {
+		o.Style.Color = color.White
+	}
+
+	if o.BandColor == nil {
+		o.BandColor = color.White
+	}
+
+	if o.Encoder == nil {
+		o.Encoder = PNGEncoder
+	}
+
+	return &Renderer{opts: o}, nil
+}
+
+// Options returns copy of renderer settings.
+func (r *Renderer) Options() RenderOptions {
+	return r.opts
+}
+
+// RenderTo renders meme and writes it to w using renderer encoder.
+func (r *Renderer) RenderTo(w io.Writer, src image.Image, top, bottom string) error {
+	dst, err := r.Render(src, top, bottom)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	c := freetype.NewContext()
-	c.SetDPI(72)
-	c.SetFont(f)
+	return r.opts.Encoder(w, dst)
+}
 
-	c.SetClip(dst.Bounds())
-	c.SetDst(dst)
-	c.SetSrc(image.White)
-	c.SetHinting(font.HintingNone)
+// Render creates new meme image with top and bottom captions drawn with
+// renderer style.
+func (r *Renderer) Render(src image.Image, top, bottom string) (draw.Image, error) {
+	return r.RenderCaptions(
+		src,
+		Caption{Text: top, Style: r.opts.Style},
+		Caption{Text: bottom, Style: r.opts.Style},
+	)
+}
 
-	// draw top text line
-	topTextWidth, topFontSize := computeFontSize(f, top, srcBounds.Dx())
-	c.SetFontSize(float64(topFontSize))
+// RenderCaptions creates new meme image with top and bottom captions drawn
+// with their own styles, captions without color use renderer color.
+func (r *Renderer) RenderCaptions(src image.Image, top, bottom Caption) (draw.Image, error) {
+	if src.Bounds().Empty() {
+		return nil, ErrEmptyImage
+	}
 
-	topPt := freetype.Pt((srcBounds.Dx()-topTextWidth)/2.0, 15+int(c.PointToFixed(72)>>6))
-	if _, err := c.DrawString(top, topPt); err != nil {
-		return nil, err
+	s := r.scene(src, top, bottom)
+	for _, l := range s.lines {
+		r.drawRuns(s.canvas, l)
 	}
 
-	// draw bottom text line
-	bottomTextWidth, bottomFontSize := computeFontSize(f, bottom, srcBounds.Dx())
-	c.SetFontSize(float64(bottomFontSize))
+	return applyEffects(s.canvas, r.opts.PostEffects), nil
+}
+
+// captionScene is meme laid out before captions are drawn, it is shared by
+// raster and SVG output.
+type captionScene struct {
+	// canvas is whole meme without captions
+	canvas draw.Image
 
-	bottomPt := freetype.Pt((srcBounds.Dx()-bottomTextWidth)/2.0, (src.Bounds().Dy()-100)+int(c.PointToFixed(72)>>6))
-	if _, err := c.DrawString(bottom, bottomPt); err != nil {
-		return nil, err
+	// picture is template with overlays, effects and text boxes placed at
+	// offset of canvas, in overlay layout it is canvas itself
+	picture draw.Image
+	offset  image.Point
+
+	// band is color of caption bands, nil without bands
+	band color.Color
+
+	// lines are caption lines with auto colors already picked
+	lines []*captionLayout
+}
+
+// scene lays out captions over template using renderer layout.
+func (r *Renderer) scene(src image.Image, top, bottom Caption) *captionScene {
+	if r.opts.Layout == LayoutBands {
+		return r.sceneBands(src, top, bottom)
+	}
+
+	return r.sceneOverlay(src, top, bottom)
+}
+
+// sceneOverlay lays out captions over top and bottom edge of template.
+func (r *Renderer) sceneOverlay(src image.Image, top, bottom Caption) *captionScene {
+	dst := applyEffects(r.template(src), r.opts.PreEffects)
+	r.drawTextBoxes(dst)
+	dstBounds := dst.Bounds()
+
+	left := r.opts.Margins.Left
+	width := dstBounds.Dx() - r.opts.Margins.Left - r.opts.Margins.Right
+
+	// top caption hangs from top margin, bottom caption sits on bottom margin
+	topLayout := r.layoutCaption(top, left, width, func(m font.Metrics) fixed.Int26_6 {
+		return fixed.I(r.opts.Margins.Top) + m.Ascent
+	})
+
+	bottomLayout := r.layoutCaption(bottom, left, width, func(m font.Metrics) fixed.Int26_6 {
+		return fixed.I(dstBounds.Dy()-r.opts.Margins.Bottom) - m.Descent
+	})
+
+	// both captions sample template before any text is drawn
+	lines := []*captionLayout{topLayout, bottomLayout}
+	for _, l := range lines {
+		if l.style.AutoColor {
+			r.autoContrast(dst, l.bounds(), l)
+		}
+	}
+
+	return &captionScene{
+		canvas:  dst,
+		picture: dst,
+		lines:   lines,
+	}
+}
+
+// sceneBands lays out captions in bands added above and below template.
+// Output size applies to template, bands make image taller.
+func (r *Renderer) sceneBands(src image.Image, top, bottom Caption) *captionScene {
+	picture := applyEffects(r.template(src), r.opts.PreEffects)
+	r.drawTextBoxes(picture)
+	pictureBounds := picture.Bounds()
+
+	left := r.opts.Margins.Left
+	width := pictureBounds.Dx() - r.opts.Margins.Left - r.opts.Margins.Right
+
+	topLines, topHeight := r.layoutBand(top, left, width, 0)
+	bottomLines, bottomHeight := r.layoutBand(bottom, left, width, topHeight+pictureBounds.Dy())
+
+	dst := newCanvas(image.Rect(0, 0, pictureBounds.Dx(), topHeight+pictureBounds.Dy()+bottomHeight), isHighPrecision(src))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(r.opts.BandColor), image.Point{}, draw.Src)
+	draw.Draw(dst, pictureBounds.Add(image.Pt(0, topHeight)), picture, pictureBounds.Min, draw.Src)
+
+	lines := append(topLines, bottomLines...)
+	for _, l := range lines {
+		if l.style.AutoColor {
+			r.autoContrast(dst, l.bounds(), l)
+		}
+	}
+
+	return &captionScene{
+		canvas:  dst,
+		picture: picture,
+		offset:  image.Pt(0, topHeight),
+		band:    r.opts.BandColor,
+		lines:   lines,
+	}
+}
+
+// template creates canvas with template and overlays composited over it.
+func (r *Renderer) template(src image.Image) draw.Image {
+	dst := r.canvas(src)
+	drawOverlays(dst, r.opts.Overlays)
+
+	return dst
+}
+
+// canvas creates image of output size with template drawn on it.
+func (r *Renderer) canvas(src image.Image) draw.Image {
+	srcBounds := src.Bounds()
+
+	width, height := r.opts.Width, r.opts.Height
+	switch {
+	case width == 0 && height == 0:
+		width, height = srcBounds.Dx(), srcBounds.Dy()
+	case width == 0:
+		width = srcBounds.Dx() * height / srcBounds.Dy()
+	case height == 0:
+		height = srcBounds.Dy() * width / srcBounds.Dx()
+	}
+
+	newImage := newCanvas(image.Rect(0, 0, width, height), isHighPrecision(src))
+	if width == srcBounds.Dx() && height == srcBounds.Dy() {
+		draw.Draw(newImage, newImage.Bounds(), src, srcBounds.Min, draw.Src)
+	} else {
+		xdraw.CatmullRom.Scale(newImage, newImage.Bounds(), src, srcBounds, draw.Src, nil)
+	}
+
+	return newImage
+}
+
+// newCanvas creates empty image, 8-bit image is enough for 8-bit templates
+// and takes half the memory.
+func newCanvas(rect image.Rectangle, highPrecision bool) draw.Image {
+	if highPrecision {
+		return image.NewNRGBA64(rect)
+	}
+
+	return image.NewNRGBA(rect)
+}
+
+// isHighPrecision reports whether image has more than 8 bits per channel.
+func isHighPrecision(img image.Image) bool {
+	switch img.(type) {
+	case *image.NRGBA64, *image.RGBA64, *image.Gray16:
+		return true
 	}
 
-	return dst, nil
+	return false
+}
+
+// drawRuns draws text runs of caption one after another starting at its dot.
+func (r *Renderer) drawRuns(dst draw.Image, l *captionLayout) {
+	tracking := r.tracking(l.size, l.style.LetterSpacing)
+
+	pt := l.dot
+	for _, run := range l.runs {
+		size := run.fontSize(l.size)
+		if run.bitmap != nil {
+			pt.X += r.drawBitmap(dst, run.bitmap, size, pt) + tracking
+			continue
+		}
+
+		pt.X += r.drawString(dst, run.font, size, run.text, pt, &l.style, tracking)
+	}
 }
 
-// computeFontSize computes optimal size for text based on text length.
-func computeFontSize(f *truetype.Font, text string, width int) (int, int) {
-	for _, size := range []fixed.Int26_6{72, 48, 36, 24} {
-		textWidth := fixed.Int26_6(0)
+// drawString draws text with its outline at point using pooled face and
+// returns its advance. Tracking is added after every glyph.
+func (r *Renderer) drawString(dst draw.Image, f *truetype.Font, size float64, text string, pt fixed.Point26_6, style *TextStyle, tracking fixed.Int26_6) fixed.Int26_6 {
+	face, release := acquireFace(f, size, r.opts.DPI, r.opts.Hinting)
+	defer release()
+
+	d := &font.Drawer{
+		Dst:  dst,
+		Face: face,
+	}
+
+	if style.OutlineColor != nil && style.OutlineWidth > 0 {
+		d.Src = image.NewUniform(style.OutlineColor)
 
-		for _, r := range text {
-			textWidth += f.HMetric(size, f.Index(r)).AdvanceWidth
+		ow := style.OutlineWidth
+		for dy := -ow; dy <= ow; dy++ {
+			for dx := -ow; dx <= ow; dx++ {
+				if dx*dx+dy*dy > ow*ow || dx == 0 && dy == 0 {
+					continue
+				}
+
+				d.Dot = fixed.Point26_6{
+					X: pt.X + fixed.I(dx),
+					Y: pt.Y + fixed.I(dy),
+				}
+				drawTracked(d, text, tracking)
+			}
 		}
+	}
+
+	d.Src = image.NewUniform(style.Color)
+	d.Dot = pt
+	drawTracked(d, text, tracking)
+
+	return d.Dot.X - pt.X
+}
+
+// drawTracked draws text with drawer adding tracking after every glyph.
+func drawTracked(d *font.Drawer, text string, tracking fixed.Int26_6) {
+	if tracking == 0 {
+		d.DrawString(text)
+		return
+	}
 
-		if textWidth <= fixed.Int26_6(width) {
-			return int(textWidth), int(size)
+	prev := rune(-1)
+	for _, c := range text {
+		if prev >= 0 {
+			d.Dot.X += d.Face.Kern(prev, c)
 		}
+
+		d.DrawString(string(c))
+		d.Dot.X += tracking
+		prev = c
+	}
+}
+
+// drawBitmap draws bitmap glyph scaled to font size with its bottom on the
+// baseline and returns its advance.
+func (r *Renderer) drawBitmap(dst draw.Image, glyph image.Image, size float64, pt fixed.Point26_6) fixed.Int26_6 {
+	advance := r.bitmapAdvance(glyph, size)
+	if advance == 0 {
+		return 0
+	}
+
+	bounds := glyph.Bounds()
+	height := int(size * r.opts.DPI / 72)
+	width := advance.Round()
+	x, y := pt.X.Round(), pt.Y.Round()
+	rect := image.Rect(x, y-height, x+width, y)
+
+	xdraw.ApproxBiLinear.Scale(dst, rect, glyph, bounds, draw.Over, nil)
+
+	return advance
+}
+
+// RenderMeme handles creating new meme image with text. It is kept for
+// compatibility, use Renderer for any other settings.
+func RenderMeme(fontBytes []byte, src image.Image, top, bottom string) (draw.Image, error) {
+	f, err := parseFontCached(fontBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewRenderer(WithFonts(f))
+	if err != nil {
+		return nil, err
 	}
 
-	return 0, 24
+	return r.Render(src, top, bottom)
 }
@@ -0,0 +1,154 @@
+package memecreator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// RenderSVG writes meme as SVG document. Template with overlays, effects
+// applied before captions and text boxes is embedded as PNG data URI and
+// captions are text elements laid out the same way as in raster memes, so
+// they stay editable in vector tools. Effects applied after captions are
+// raster only and are skipped, memes with them can't use svg format.
+func (r *Renderer) RenderSVG(w io.Writer, src image.Image, top, bottom Caption) error {
+	if src.Bounds().Empty() {
+		return ErrEmptyImage
+	}
+
+	s := r.scene(src, top, bottom)
+	size := s.canvas.Bounds().Size()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", size.X, size.Y, size.X, size.Y)
+
+	if s.band != nil {
+		fmt.Fprintf(bw, `<rect width="%d" height="%d"%s/>`+"\n", size.X, size.Y, svgPaint("fill", s.band))
+	}
+
+	pictureSize := s.picture.Bounds().Size()
+	fmt.Fprintf(bw, `<image x="%d" y="%d" width="%d" height="%d" xlink:href="data:image/png;base64,`, s.offset.X, s.offset.Y, pictureSize.X, pictureSize.Y)
+	enc := base64.NewEncoder(base64.StdEncoding, bw)
+	if err := png.Encode(enc, s.picture); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(bw, `"/>`+"\n")
+
+	for _, l := range s.lines {
+		r.writeSVGLine(bw, l)
+	}
+
+	fmt.Fprintf(bw, "</svg>\n")
+
+	return bw.Flush()
+}
+
+// writeSVGLine writes caption line as text element starting at its dot.
+// Every run is separate tspan with its font, text length keeps line width
+// computed by layout when viewer uses different font metrics.
+func (r *Renderer) writeSVGLine(w io.Writer, l *captionLayout) {
+	if len(l.runs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, `<text x="%s" y="%s" font-family="%s" font-size="%s"%s`,
+		svgFixed(l.dot.X), svgFixed(l.dot.Y), svgFontFamily(r.opts.Fonts[0]), svgNumber(l.size*r.opts.DPI/72), svgPaint("fill", l.style.Color))
+
+	// stroke is centered on glyph edges, fill painted over its inner half
+	if l.style.OutlineColor != nil && l.style.OutlineWidth > 0 {
+		fmt.Fprintf(w, `%s stroke-width="%d" stroke-linejoin="round" paint-order="stroke"`,
+			svgPaint("stroke", l.style.OutlineColor), 2*l.style.OutlineWidth)
+	}
+
+	if tracking := r.tracking(l.size, l.style.LetterSpacing); tracking != 0 {
+		fmt.Fprintf(w, ` letter-spacing="%s"`, svgFixed(tracking))
+	}
+
+	fmt.Fprintf(w, ` textLength="%s" lengthAdjust="spacingAndGlyphs" xml:space="preserve">`, svgFixed(l.width))
+
+	for _, run := range l.runs {
+		fmt.Fprintf(w, "<tspan")
+		if run.font != nil && run.font != r.opts.Fonts[0] {
+			fmt.Fprintf(w, ` font-family="%s"`, svgFontFamily(run.font))
+		}
+		if run.small {
+			fmt.Fprintf(w, ` font-size="%s"`, svgNumber(run.fontSize(l.size)*r.opts.DPI/72))
+		}
+		fmt.Fprintf(w, ">")
+		xml.EscapeText(w, []byte(run.text))
+		fmt.Fprintf(w, "</tspan>")
+	}
+
+	fmt.Fprintf(w, "</text>\n")
+}
+
+// svgFontFamily returns font-family value with family name of font and
+// generic fallback.
+func svgFontFamily(f *truetype.Font) string {
+	family := f.Name(truetype.NameIDFontFamily)
+	if family == "" {
+		return "sans-serif"
+	}
+
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(family))
+	return "'" + b.String() + "', sans-serif"
+}
+
+// svgPaint returns fill or stroke attribute with hex color, translucent
+// colors get opacity attribute too.
+func svgPaint(attr string, c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+
+	paint := fmt.Sprintf(` %s="#%02x%02x%02x"`, attr, n.R, n.G, n.B)
+	if n.A != 0xff {
+		paint += fmt.Sprintf(` %s-opacity="%s"`, attr, svgNumber(float64(n.A)/0xff))
+	}
+
+	return paint
+}
+
+// validateSVGEffects checks that memes in svg format have no effects applied
+// after captions, captions are text elements which effects can't change.
+func validateSVGEffects(cmd *CreateMemeCommand) []*ValidationError {
+	if cmd.Output.Format != FormatSVG {
+		return nil
+	}
+
+	var errs []*ValidationError
+	for i, spec := range cmd.Effects {
+		if spec.Stage == "" || spec.Stage == EffectStageAfter {
+			errs = append(errs, &ValidationError{
+				Field:   fmt.Sprintf("effects[%d].stage", i),
+				Message: "svg format supports only effects applied before captions",
+			})
+		}
+	}
+
+	return errs
+}
+
+// svgFixed formats fixed point number in pixels.
+func svgFixed(v fixed.Int26_6) string {
+	return svgNumber(float64(v) / 64)
+}
+
+// svgNumber formats number with at most two decimal places.
+func svgNumber(v float64) string {
+	s := strings.TrimRight(fmt.Sprintf("%.2f", v), "0")
+	return strings.TrimSuffix(s, ".")
+}
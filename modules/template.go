@@ -1,11 +1,16 @@
 package memecreator
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"image"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
 	"time"
 
@@ -15,6 +20,7 @@ import (
 	"google.golang.org/appengine/file"
 	"google.golang.org/appengine/log"
 	"google.golang.org/appengine/memcache"
+	"google.golang.org/appengine/user"
 )
 
 const (
@@ -25,10 +31,17 @@ const (
 	TemplateKind = "Template"
 )
 
-// Template is type used for storing details about template.
+// Template is type used for storing details about template. Master is
+// normalized copy of uploaded file memes are rendered from, templates
+// uploaded before normalization have none. Caption styles are defaults for
+// memes using template.
 type Template struct {
-	Created  time.Time `json:"created"`
-	Filename string    `json:"filename"`
+	Created     time.Time    `json:"created"`
+	Filename    string       `json:"filename"`
+	Private     bool         `json:"private"`
+	Master      string       `json:"master,omitempty"`
+	TopStyle    CaptionStyle `json:"top_style"`
+	BottomStyle CaptionStyle `json:"bottom_style"`
 }
 
 // TemplateResponse is type returned as response from API.
@@ -45,9 +58,7 @@ func TemplatesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method != http.MethodPost {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprint(w, `{"error":"method not allowed"}`)
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -64,19 +75,22 @@ func GetTemplatesHandler(w http.ResponseWriter, r *http.Request) {
 		GetAll(ctx, &templates)
 	if err != nil {
 		log.Errorf(ctx, "fetching template from datastore failed, error %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
+	// private templates are uploaded together with single meme, missing
+	// property on older entities can't be filtered in query
+	publicTemplates := make([]*TemplateResponse, 0, len(templates))
 	for i, t := range templates {
-		t.ID = keys[i].Encode()
-	}
+		if t.Private {
+			continue
+		}
 
-	if templates == nil {
-		templates = make([]*TemplateResponse, 0)
+		t.ID = keys[i].Encode()
+		publicTemplates = append(publicTemplates, t)
 	}
+	templates = publicTemplates
 
 	resp := map[string]interface{}{
 		"templates": templates,
@@ -85,8 +99,7 @@ func GetTemplatesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Errorf(ctx, "fetching template from datastore failed, error %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 }
@@ -95,125 +108,204 @@ func GetTemplatesHandler(w http.ResponseWriter, r *http.Request) {
 func PostTemplatesHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
 
-	if err := r.ParseMultipartForm(MaxTemplateSize); err != nil {
-		log.Errorf(ctx, "parsing multipart form failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, `{"error":"template is too large"}`)
+	if !parseMultipartForm(ctx, w, r, MaxTemplateSize, ErrorCodeTemplateTooLarge, "template is too large") {
 		return
 	}
 
 	templateFile, templateHandler, err := r.FormFile("template")
 	if err != nil {
 		log.Errorf(ctx, "getting multipart form template object failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, `{"error":"missing template file in request"}`)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeMissingTemplateFile, "missing template file in request")
 		return
 	}
 	defer templateFile.Close()
 
-	storageClient, err := storage.NewClient(ctx)
+	topStyle, topErr := captionStyleFromForm(r.MultipartForm.Value, "top")
+	bottomStyle, bottomErr := captionStyleFromForm(r.MultipartForm.Value, "bottom")
+	if topErr != nil || bottomErr != nil {
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
+		return
+	}
+
+	opts, err := templateOptionsFromForm(r.MultipartForm.Value)
 	if err != nil {
-		log.Errorf(ctx, "getting storage client failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeInvalidRequest, "parsing request failed")
 		return
 	}
 
-	bucketName, err := file.DefaultBucketName(ctx)
+	templateBytes, err := ioutil.ReadAll(templateFile)
 	if err != nil {
-		log.Errorf(ctx, "getting storage bucket name failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		log.Errorf(ctx, "reading template file failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	cso := storageClient.
-		Bucket(bucketName).
-		Object(templateHandler.Filename)
+	validationErrs := validateCaptionStyle("top_style", topStyle)
+	validationErrs = append(validationErrs, validateCaptionStyle("bottom_style", bottomStyle)...)
+	validationErrs = append(validationErrs, validateTemplateOptions(opts)...)
+
+	var master image.Image
+	var format string
+	if len(validationErrs) == 0 {
+		master, format, err = normalizeTemplate(templateBytes, opts)
+		switch err {
+		case nil:
+		case errCropOutside:
+			validationErrs = append(validationErrs, &ValidationError{
+				Field:   "crop",
+				Message: err.Error(),
+			})
+		default:
+			validationErrs = append(validationErrs, &ValidationError{
+				Field:   "template",
+				Message: err.Error(),
+			})
+		}
+	}
 
-	csow := cso.NewWriter(ctx)
-	if _, err := io.Copy(csow, templateFile); err != nil {
-		log.Errorf(ctx, "copying data to cloud storage failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+	if len(validationErrs) > 0 {
+		writeAPIError(w, r, &APIError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidationFailed,
+			Message: "template is invalid",
+			Details: validationErrs,
+		})
 		return
 	}
 
-	if err := csow.Close(); err != nil {
-		log.Errorf(ctx, "closing cloud storage writer failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+	templateKey, err := storeTemplate(ctx, &Template{
+		Filename:    templateHandler.Filename,
+		TopStyle:    topStyle,
+		BottomStyle: bottomStyle,
+	}, templateBytes, master, format)
+	if err != nil {
+		log.Errorf(ctx, "storing template failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	if err := cso.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		log.Errorf(ctx, "setting acl on template cloud storage object failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
-		return
+	w.Header().Set("Location", fmt.Sprintf("/templates/%s", templateKey.Encode()))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// storeTemplate uploads original template file and its normalized master
+// in given format to cloud storage and stores template in datastore and
+// memcache. Private templates are stored under unique name and are not
+// readable by everyone.
+func storeTemplate(ctx context.Context, template *Template, original []byte, master image.Image, format string) (*datastore.Key, error) {
+	storageClient, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage client failed, error: %s", err)
+	}
+
+	bucketName, err := file.DefaultBucketName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage bucket name failed, error: %s", err)
+	}
+	bucket := storageClient.Bucket(bucketName)
+
+	filename := template.Filename
+	if template.Private {
+		filename = fmt.Sprintf("private/%d-%s", time.Now().UnixNano(), path.Base(filename))
 	}
 
+	if err := writeTemplateObject(ctx, bucket, filename, !template.Private, func(w io.Writer) error {
+		_, err := w.Write(original)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	// master keeps name of original with extension of its own format
+	masterBuf := new(bytes.Buffer)
+	masterExt, err := encodeMaster(masterBuf, master, format)
+	if err != nil {
+		return nil, fmt.Errorf("encoding template master failed, error: %s", err)
+	}
+
+	masterName := MasterObjectPrefix + strings.TrimSuffix(filename, path.Ext(filename)) + "." + masterExt
+	if err := writeTemplateObject(ctx, bucket, masterName, !template.Private, func(w io.Writer) error {
+		_, err := masterBuf.WriteTo(w)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	template.Created = time.Now()
+	template.Filename = filename
+	template.Master = masterName
 	templateKey, err := datastore.Put(
 		ctx,
 		datastore.NewIncompleteKey(ctx, TemplateKind, nil),
-		&Template{
-			Created:  time.Now(),
-			Filename: templateHandler.Filename,
-		},
+		template,
 	)
 	if err != nil {
-		log.Errorf(ctx, "storing template in datastore failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
-		return
+		return nil, fmt.Errorf("storing template in datastore failed, error: %s", err)
 	}
 
 	item := &memcache.Item{
 		Key:   templateKey.Encode(),
-		Value: []byte(templateHandler.Filename),
+		Value: []byte(filename),
 	}
 	if err := memcache.Add(ctx, item); err != nil {
-		log.Errorf(ctx, "storing template in memcache failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
-		return
+		return nil, fmt.Errorf("storing template in memcache failed, error: %s", err)
 	}
 
-	w.Header().Set("Location", fmt.Sprintf("/templates/%s", templateKey.Encode()))
-	w.WriteHeader(http.StatusCreated)
+	return templateKey, nil
+}
+
+// writeTemplateObject writes cloud storage object with template file using
+// write function, public objects are readable by everyone.
+func writeTemplateObject(ctx context.Context, bucket *storage.BucketHandle, name string, public bool, write func(w io.Writer) error) error {
+	cso := bucket.Object(name)
+
+	csow := cso.NewWriter(ctx)
+	if err := write(csow); err != nil {
+		csow.Close()
+		return fmt.Errorf("copying data to cloud storage failed, error: %s", err)
+	}
+
+	if err := csow.Close(); err != nil {
+		return fmt.Errorf("closing cloud storage writer failed, error: %s", err)
+	}
+
+	if public {
+		if err := cso.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+			return fmt.Errorf("setting acl on template cloud storage object failed, error: %s", err)
+		}
+	}
+
+	return nil
 }
 
-// TemplateHandler handles getting existing template.
+// TemplateHandler handles actions getting or deleting existing template.
 func TemplateHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := appengine.NewContext(r)
+	if r.Method == http.MethodGet {
+		GetTemplateHandler(w, r)
+		return
+	}
 
-	if r.Method != http.MethodGet {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprint(w, `{"error":"method not allowed"}`)
+	if r.Method != http.MethodDelete {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
 		return
 	}
 
+	DeleteTemplateHandler(w, r)
+}
+
+// GetTemplateHandler handles getting existing template.
+func GetTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
 	u, err := url.Parse(r.RequestURI)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "template not found")
 		return
 	}
 
 	templateKey, err := datastore.DecodeKey(strings.TrimPrefix(u.Path, "/templates/"))
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "template not found")
 		return
 	}
 
@@ -223,12 +315,11 @@ func TemplateHandler(w http.ResponseWriter, r *http.Request) {
 		templateKey,
 		&template,
 	); err == datastore.ErrNoSuchEntity {
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "template not found")
 		return
 	} else if err != nil {
 		log.Errorf(ctx, "getting template from datastore failed, error: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
@@ -239,8 +330,89 @@ func TemplateHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Errorf(ctx, "fetching template from datastore failed, error %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
+		return
+	}
+}
+
+// DeleteTemplateHandler handles deleting existing template with its files,
+// only admins can delete templates. Memes rendered from template are kept.
+func DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	if !user.IsAdmin(ctx) {
+		writeError(w, r, http.StatusForbidden, ErrorCodeForbidden, "only admins can delete templates")
 		return
 	}
+
+	u, err := url.Parse(r.RequestURI)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "template not found")
+		return
+	}
+
+	templateKey, err := datastore.DecodeKey(strings.TrimPrefix(u.Path, "/templates/"))
+	if err != nil || templateKey.Kind() != TemplateKind {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "template not found")
+		return
+	}
+
+	var template Template
+	if err := datastore.Get(
+		ctx,
+		templateKey,
+		&template,
+	); err == datastore.ErrNoSuchEntity {
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "template not found")
+		return
+	} else if err != nil {
+		log.Errorf(ctx, "getting template from datastore failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	storageClient, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Errorf(ctx, "getting storage client failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	bucketName, err := file.DefaultBucketName(ctx)
+	if err != nil {
+		log.Errorf(ctx, "getting storage bucket name failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	// older templates have no master
+	for _, name := range []string{template.Filename, template.Master} {
+		if name == "" {
+			continue
+		}
+
+		if err := storageClient.
+			Bucket(bucketName).
+			Object(name).
+			Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+			log.Errorf(ctx, "deleting storage object failed, error: %s", err)
+			writeInternalError(w, r)
+			return
+		}
+	}
+
+	if err := datastore.Delete(
+		ctx,
+		templateKey,
+	); err != nil {
+		log.Errorf(ctx, "deleting template from datastore failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	if err := memcache.Delete(ctx, templateKey.Encode()); err != nil && err != memcache.ErrCacheMiss {
+		log.Errorf(ctx, "deleting template from memcache failed, error: %s", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
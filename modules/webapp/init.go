@@ -12,5 +12,9 @@ func init() {
 	http.HandleFunc("/templates/", memecreator.TemplateHandler)
 	http.HandleFunc("/memes", memecreator.MemesHandler)
 	http.HandleFunc("/memes/", memecreator.MemeHandler)
+	http.HandleFunc("/memes/events", memecreator.MemesEventsHandler)
+	http.HandleFunc("/memes:batch", memecreator.PostMemesBatchHandler)
+	http.HandleFunc("/fonts", memecreator.FontsHandler)
+	http.HandleFunc("/stickers", memecreator.StickersHandler)
 	http.HandleFunc("/worker", memecreator.WorkerHandler)
 }
@@ -1,11 +1,17 @@
 package memecreator
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image"
+	"image/draw"
 	_ "image/jpeg" // allows decoding JPEG files too
-	"image/png"
+	_ "image/png"  // allows decoding PNG files too
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"google.golang.org/appengine"
@@ -14,6 +20,10 @@ import (
 	"google.golang.org/appengine/log"
 )
 
+// MemeTaskRetryLimit is number of retries of meme worker task, it must match
+// task_retry_limit of default queue in queue.yaml.
+const MemeTaskRetryLimit = 5
+
 // WorkerHandler is queue handler for generating new meme image.
 func WorkerHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := appengine.NewContext(r)
@@ -23,8 +33,7 @@ func WorkerHandler(w http.ResponseWriter, r *http.Request) {
 	memeKey, err := datastore.DecodeKey(memeID)
 	if err != nil {
 		log.Errorf(ctx, "decoding meme key failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "meme not found")
 		return
 	}
 
@@ -35,123 +44,223 @@ func WorkerHandler(w http.ResponseWriter, r *http.Request) {
 		&meme,
 	); err == datastore.ErrNoSuchEntity {
 		log.Errorf(ctx, "meme key %s not found", memeID)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, http.StatusNotFound, ErrorCodeNotFound, "meme not found")
 		return
 	} else if err != nil {
 		log.Errorf(ctx, "getting meme from datastore failed, error: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(w, r)
 		return
 	}
 
-	templateKey, err := datastore.DecodeKey(meme.TemplateID)
-	if err != nil {
-		log.Errorf(ctx, "decoding template key failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusNotFound)
+	// retried task of meme which is already done or failed
+	if isFinalMemeStatus(meme.Status) {
 		return
 	}
 
-	var template Template
-	if err := datastore.Get(
+	meme.Status = MemeStatusRendering
+	if _, err := datastore.Put(
 		ctx,
-		templateKey,
-		&template,
-	); err == datastore.ErrNoSuchEntity {
-		log.Errorf(ctx, "template key %s not found", memeID)
-		w.WriteHeader(http.StatusNotFound)
-		return
-	} else if err != nil {
-		log.Errorf(ctx, "getting template from datastore failed, error: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		memeKey,
+		&meme,
+	); err != nil {
+		log.Errorf(ctx, "updating meme in datastore failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
+	publishMemeStatus(memeID, MemeStatusRendering)
+
+	// failures below put meme back to queue for task retry. Failed status is
+	// final, so it is set only when failure is permanent or on last retry,
+	// permanent failures respond with 200, so task queue doesn't retry them.
+	done, permanent := false, false
+	defer func() {
+		if done {
+			return
+		}
+
+		meme.Status = MemeStatusQueued
+		if permanent || lastTaskRetry(r) {
+			meme.Status = MemeStatusFailed
+		}
+
+		if _, err := datastore.Put(
+			ctx,
+			memeKey,
+			&meme,
+		); err != nil {
+			log.Errorf(ctx, "updating meme in datastore failed, error: %s", err)
+		}
+		publishMemeStatus(memeID, meme.Status)
+	}()
 
 	storageClient, err := storage.NewClient(ctx)
 	if err != nil {
 		log.Errorf(ctx, "getting storage client failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
 	bucketName, err := file.DefaultBucketName(ctx)
 	if err != nil {
 		log.Errorf(ctx, "getting storage bucket name failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		writeInternalError(w, r)
 		return
 	}
 
-	templateReader, err := storageClient.
-		Bucket(bucketName).
-		Object(template.Filename).
-		NewReader(ctx)
+	memeFont, err := loadFont(ctx, meme.FontID)
 	if err != nil {
-		log.Errorf(ctx, "getting storage object failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		log.Errorf(ctx, "loading font failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
-	defer templateReader.Close()
 
-	templateImage, _, err := image.Decode(templateReader)
+	overlays, err := loadOverlays(meme.Overlays, func(stickerID string) (image.Image, error) {
+		return loadSticker(ctx, storageClient.Bucket(bucketName), stickerID)
+	})
 	if err != nil {
-		log.Errorf(ctx, "decoding template image failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		log.Errorf(ctx, "loading overlays failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	memeResult, err := RenderMeme(WorkerFontBytes, templateImage, meme.Top, meme.Bottom)
+	renderer, err := NewRenderer(append(
+		meme.renderOptions(),
+		WithFonts(fallbackFonts(ctx, memeFont)...),
+		WithOverlays(overlays...),
+	)...)
 	if err != nil {
-		log.Errorf(ctx, "rendering meme failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+		log.Errorf(ctx, "creating renderer failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
 
-	cso := storageClient.
-		Bucket(bucketName).
-		Object(memeID + ".png")
+	// every panel is rendered as separate meme with the same settings
+	panels := meme.panels()
+	panelImages := make([]draw.Image, len(panels))
+	var svg bytes.Buffer
+	for i, panel := range panels {
+		template, templateImage, err := loadTemplate(ctx, storageClient.Bucket(bucketName), panel.TemplateID)
+		if err == datastore.ErrNoSuchEntity {
+			log.Errorf(ctx, "template key %s not found", panel.TemplateID)
+			permanent = true
+			return
+		} else if err != nil {
+			log.Errorf(ctx, "loading template failed, error: %s", err)
+			writeInternalError(w, r)
+			return
+		}
 
-	csow := cso.NewWriter(ctx)
-	if err := png.Encode(csow, memeResult); err != nil {
-		log.Errorf(ctx, "copying rendered file to cloud storage failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
-		return
-	}
+		// meme styles override template default styles
+		style := renderer.Options().Style
+		top := Caption{
+			Text:  panel.Top,
+			Style: template.TopStyle.merge(panel.TopStyle).textStyle(style),
+		}
+		bottom := Caption{
+			Text:  panel.Bottom,
+			Style: template.BottomStyle.merge(panel.BottomStyle).textStyle(style),
+		}
 
-	if err := csow.Close(); err != nil {
-		log.Errorf(ctx, "closing rendered file storage writer failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
-		return
+		// SVG memes are validated to have single panel
+		if meme.Output.Format == FormatSVG {
+			if err := renderer.RenderSVG(&svg, templateImage, top, bottom); err != nil {
+				log.Errorf(ctx, "rendering meme failed, error: %s", err)
+				writeInternalError(w, r)
+				return
+			}
+			continue
+		}
+
+		panelImages[i], err = renderer.RenderCaptions(templateImage, top, bottom)
+		if err != nil {
+			log.Errorf(ctx, "rendering meme failed, error: %s", err)
+			writeInternalError(w, r)
+			return
+		}
 	}
 
-	if err := cso.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
-		log.Errorf(ctx, "setting acl on template cloud storage object failed, error: %s", err)
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, `{"error":"something went wrong ;("}`)
+	var variants []string
+	var size int64
+	if meme.Output.Format == FormatSVG {
+		size, err = storeMemeObject(ctx, storageClient.Bucket(bucketName), meme.Output.objectName(memeID), meme.Output.contentType(), func(w io.Writer) error {
+			_, err := svg.WriteTo(w)
+			return err
+		})
+		variants = []string{VariantOriginal}
+	} else {
+		variants, size, err = storeMemeVariants(ctx, storageClient.Bucket(bucketName), memeID, meme.Output, meme.composePanels(panelImages), meme.RequestedVariants)
+	}
+	if err != nil {
+		log.Errorf(ctx, "storing rendered meme failed, error: %s", err)
+		writeInternalError(w, r)
 		return
 	}
+	meme.VariantNames = variants
+	meme.Size = size
 
-	meme.Status = "done"
+	meme.Status = MemeStatusDone
 	if _, err := datastore.Put(
 		ctx,
 		memeKey,
 		&meme,
 	); err != nil {
 		log.Errorf(ctx, "updating meme in datastore failed, error: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeInternalError(w, r)
 		return
 	}
+
+	done = true
+	publishMemeStatus(memeID, MemeStatusDone)
+}
+
+// loadTemplate gets template from datastore and decodes its master image,
+// malformed and missing templates are reported as datastore.ErrNoSuchEntity.
+func loadTemplate(ctx context.Context, bucket *storage.BucketHandle, templateID string) (*Template, image.Image, error) {
+	templateKey, err := datastore.DecodeKey(templateID)
+	if err != nil {
+		return nil, nil, datastore.ErrNoSuchEntity
+	}
+
+	var template Template
+	if err := datastore.Get(
+		ctx,
+		templateKey,
+		&template,
+	); err != nil {
+		return nil, nil, err
+	}
+
+	// older templates have no normalized master
+	templateFilename := template.Master
+	if templateFilename == "" {
+		templateFilename = template.Filename
+	}
+
+	templateReader, err := bucket.Object(templateFilename).NewReader(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting storage object failed, error: %s", err)
+	}
+	defer templateReader.Close()
+
+	templateImage, _, err := image.Decode(templateReader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding template image failed, error: %s", err)
+	}
+
+	return &template, templateImage, nil
+}
+
+// lastTaskRetry reports whether task queue won't retry task of request again.
+func lastTaskRetry(r *http.Request) bool {
+	retries, err := strconv.Atoi(r.Header.Get("X-AppEngine-TaskRetryCount"))
+	return err == nil && retries >= MemeTaskRetryLimit
+}
+
+// publishMemeStatus publishes meme status transition to meme events broker.
+func publishMemeStatus(memeID, status string) {
+	MemeEvents.Publish(MemeEvent{
+		MemeID: memeID,
+		Status: status,
+		Time:   time.Now(),
+	})
 }
@@ -0,0 +1,74 @@
+package memecreator
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestOutputFormatEncoder(t *testing.T) {
+	src := testTemplate(160, 120)
+
+	for _, tt := range []struct {
+		output OutputFormat
+		decode func(*bytes.Reader) (image.Image, error)
+	}{
+		{OutputFormat{}, func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }},
+		{OutputFormat{Format: FormatPNG, Compression: "best"}, func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }},
+		{OutputFormat{Format: FormatJPEG, Quality: 60}, func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) }},
+		{OutputFormat{Format: FormatPalettedPNG, Colors: 16}, func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) }},
+	} {
+		var buf bytes.Buffer
+		if err := tt.output.encoder()(&buf, src); err != nil {
+			t.Fatalf("encoding %+v failed, error: %s", tt.output, err)
+		}
+
+		img, err := tt.decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("decoding %+v failed, error: %s", tt.output, err)
+		}
+
+		if !img.Bounds().Eq(src.Bounds()) {
+			t.Errorf("%+v has bounds %v, want %v", tt.output, img.Bounds(), src.Bounds())
+		}
+
+		if p, ok := img.(*image.Paletted); tt.output.Format == FormatPalettedPNG && (!ok || len(p.Palette) > 16) {
+			t.Errorf("%+v is not paletted image with at most 16 colors", tt.output)
+		}
+	}
+}
+
+func TestMedianCutPalette(t *testing.T) {
+	palette := medianCutPalette(testTemplate(64, 64), 8)
+	if len(palette) != 8 {
+		t.Fatalf("palette has %d colors, want 8", len(palette))
+	}
+
+	// two colors image needs only two palette entries
+	two := image.NewGray(image.Rect(0, 0, 8, 8))
+	two.Pix[0] = 0xff
+	if palette := medianCutPalette(two, 8); len(palette) != 2 {
+		t.Errorf("palette of two colors image has %d colors, want 2", len(palette))
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, tt := range []struct {
+		output OutputFormat
+		errs   int
+	}{
+		{OutputFormat{}, 0},
+		{OutputFormat{Format: FormatJPEG, Quality: 85}, 0},
+		{OutputFormat{Format: FormatPalettedPNG, Colors: 64, Compression: "best"}, 0},
+		{OutputFormat{Format: "webp"}, 1},
+		{OutputFormat{Format: FormatJPEG, Quality: 101}, 1},
+		{OutputFormat{Format: FormatPalettedPNG, Colors: 1000}, 1},
+		{OutputFormat{Compression: "max"}, 1},
+	} {
+		if errs := validateOutputFormat(tt.output); len(errs) != tt.errs {
+			t.Errorf("output %+v has %d errors, want %d", tt.output, len(errs), tt.errs)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// Overlay is image composited over template before captions are drawn.
+type Overlay struct {
+	Image image.Image
+
+	// X and Y are position of overlay center relative to template size,
+	// 0,0 is top left and 1,1 bottom right corner.
+	X, Y float64
+
+	// Scale is width of overlay relative to template width, aspect ratio
+	// of overlay image is kept.
+	Scale float64
+
+	// Rotation is clockwise rotation in degrees around overlay center.
+	Rotation float64
+
+	// Opacity from 0 to 1, fully transparent overlays are not drawn.
+	Opacity float64
+}
+
+// WithOverlays sets images composited over template in given order.
+func WithOverlays(overlays ...Overlay) RenderOption {
+	return func(o *RenderOptions) {
+		o.Overlays = overlays
+	}
+}
+
+// drawOverlays composites overlays over image in order.
+func drawOverlays(dst draw.Image, overlays []Overlay) {
+	for _, o := range overlays {
+		drawOverlay(dst, o)
+	}
+}
+
+// drawOverlay scales, rotates and composites single overlay with its
+// opacity.
+func drawOverlay(dst draw.Image, o Overlay) {
+	srcBounds := o.Image.Bounds()
+	dstBounds := dst.Bounds()
+	if srcBounds.Empty() || o.Opacity <= 0 || o.Scale <= 0 {
+		return
+	}
+
+	// maps overlay pixels around its center to dst center, scaled and
+	// rotated clockwise which is counterclockwise rotation with y down
+	scale := o.Scale * float64(dstBounds.Dx()) / float64(srcBounds.Dx())
+	sin, cos := math.Sincos(o.Rotation * math.Pi / 180)
+	a, b := scale*cos, -scale*sin
+	d, e := scale*sin, scale*cos
+
+	srcX := float64(srcBounds.Min.X) + float64(srcBounds.Dx())/2
+	srcY := float64(srcBounds.Min.Y) + float64(srcBounds.Dy())/2
+	dstX := float64(dstBounds.Min.X) + o.X*float64(dstBounds.Dx())
+	dstY := float64(dstBounds.Min.Y) + o.Y*float64(dstBounds.Dy())
+
+	s2d := f64.Aff3{
+		a, b, dstX - a*srcX - b*srcY,
+		d, e, dstY - d*srcX - e*srcY,
+	}
+
+	opts := &xdraw.Options{}
+	if o.Opacity < 1 {
+		opts.SrcMask = image.NewUniform(color.Alpha16{A: uint16(o.Opacity * 0xffff)})
+	}
+
+	xdraw.CatmullRom.Transform(dst, s2d, o.Image, srcBounds, draw.Over, opts)
+}
@@ -0,0 +1,137 @@
+package memecreator
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testSticker returns opaque red image of given size.
+func testSticker(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	return img
+}
+
+// redBounds returns bounds of pure red pixels of image.
+func redBounds(img image.Image) image.Rectangle {
+	var r image.Rectangle
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.R == 255 && c.G == 0 && c.B == 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return r
+}
+
+func TestDrawOverlayPosition(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	drawOverlay(dst, Overlay{Image: testSticker(10, 20), X: 0.25, Y: 0.5, Scale: 0.2, Opacity: 1})
+
+	// 20x40 sticker centered at 25,50, edges are resampled
+	got := redBounds(dst)
+	want := image.Rect(15, 30, 35, 70)
+	if !got.In(want) || got.Dx() < want.Dx()-2 || got.Dy() < want.Dy()-2 {
+		t.Errorf("overlay covers %v, want about %v", got, want)
+	}
+}
+
+func TestDrawOverlayRotation(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	drawOverlay(dst, Overlay{Image: testSticker(10, 20), X: 0.5, Y: 0.5, Scale: 0.2, Rotation: 90, Opacity: 1})
+
+	// rotated sticker is wider than tall
+	got := redBounds(dst)
+	if got.Dx() <= got.Dy() {
+		t.Errorf("rotated overlay covers %v, want wider than tall", got)
+	}
+}
+
+func TestDrawOverlayOpacity(t *testing.T) {
+	dst := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	drawOverlay(dst, Overlay{Image: testSticker(10, 10), X: 0.5, Y: 0.5, Scale: 0.5, Opacity: 0.5})
+
+	c := dst.NRGBAAt(50, 50)
+	if c.R != 255 || c.G < 120 || c.G > 135 {
+		t.Errorf("half transparent overlay over white is %v, want light red", c)
+	}
+
+	if c := dst.NRGBAAt(5, 5); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel outside of overlay is %v, want white", c)
+	}
+}
+
+func TestValidateOverlays(t *testing.T) {
+	for _, tt := range []struct {
+		overlays []OverlaySpec
+		errs     int
+	}{
+		{nil, 0},
+		{[]OverlaySpec{{StickerID: "not a key"}}, 1},
+		{[]OverlaySpec{{StickerID: "not a key", X: 3, Scale: 5, Rotation: 720, Opacity: 2}}, 5},
+		{make([]OverlaySpec, MaxOverlays+1), MaxOverlays + 2},
+	} {
+		if errs := validateOverlays(tt.overlays); len(errs) != tt.errs {
+			t.Errorf("overlays %+v have %d errors, want %d", tt.overlays, len(errs), tt.errs)
+		}
+	}
+}
+
+func TestStickerObjectName(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	for _, tt := range []struct {
+		name    string
+		private bool
+		want    string
+	}{
+		{"doge.png", false, "stickers/1500000000000000000-doge.png"},
+		{"../faces/me.png", true, "stickers/private/1500000000000000000-me.png"},
+	} {
+		if got := stickerObjectName(tt.name, tt.private, now); got != tt.want {
+			t.Errorf("object of %s is %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if a, b := stickerObjectName("doge.png", false, now), stickerObjectName("doge.png", false, now.Add(time.Nanosecond)); a == b {
+		t.Errorf("stickers with the same file name share object %q", a)
+	}
+}
+
+func TestPostStickersHandlerPublicNeedsAdmin(t *testing.T) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("sticker", "doge.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(fw, testSticker(8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// test requests have no user
+	r := httptest.NewRequest("POST", "/stickers", body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	PostStickersHandler(w, r)
+
+	if apiErr := decodeAPIError(t, w); w.Code != http.StatusForbidden || apiErr.Code != ErrorCodeForbidden {
+		t.Errorf("public sticker upload has status %d and code %q, want %d and %q", w.Code, apiErr.Code, http.StatusForbidden, ErrorCodeForbidden)
+	}
+}
@@ -0,0 +1,171 @@
+package memecreator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegWithOrientation encodes image as JPEG with EXIF APP1 segment holding
+// orientation in given byte order.
+func jpegWithOrientation(t *testing.T, img image.Image, orientation uint16, order binary.ByteOrder) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(app1)+2))
+	segment = append(segment, app1...)
+
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...)
+}
+
+// quadrants creates image with red top left, green top right, blue bottom
+// left and white bottom right quarter.
+func quadrants(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{A: 0xff}
+			switch {
+			case x < w/2 && y < h/2:
+				c.R = 0xff
+			case y < h/2:
+				c.G = 0xff
+			case x < w/2:
+				c.B = 0xff
+			default:
+				c = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestExifOrientation(t *testing.T) {
+	img := quadrants(32, 16)
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for o := uint16(1); o <= 8; o++ {
+			if got := exifOrientation(jpegWithOrientation(t, img, o, order)); got != int(o) {
+				t.Errorf("%v orientation %d is read as %d", order, o, got)
+			}
+		}
+	}
+
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := exifOrientation(plain.Bytes()); got != 1 {
+		t.Errorf("orientation of JPEG without EXIF is %d, want 1", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	img := quadrants(4, 2)
+
+	for _, tt := range []struct {
+		orientation int
+		size        image.Point
+		topLeft     color.NRGBA
+	}{
+		{1, image.Pt(4, 2), color.NRGBA{0xff, 0, 0, 0xff}},
+		{2, image.Pt(4, 2), color.NRGBA{0, 0xff, 0, 0xff}},
+		{3, image.Pt(4, 2), color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{4, image.Pt(4, 2), color.NRGBA{0, 0, 0xff, 0xff}},
+		{5, image.Pt(2, 4), color.NRGBA{0xff, 0, 0, 0xff}},
+		{6, image.Pt(2, 4), color.NRGBA{0, 0, 0xff, 0xff}},
+		{7, image.Pt(2, 4), color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{8, image.Pt(2, 4), color.NRGBA{0, 0xff, 0, 0xff}},
+	} {
+		upright := orient(img, tt.orientation)
+
+		if size := upright.Bounds().Size(); size != tt.size {
+			t.Errorf("orientation %d has size %v, want %v", tt.orientation, size, tt.size)
+			continue
+		}
+
+		if c := color.NRGBAModel.Convert(upright.At(0, 0)); c != tt.topLeft {
+			t.Errorf("orientation %d has top left %v, want %v", tt.orientation, c, tt.topLeft)
+		}
+	}
+}
+
+func TestNormalizeTemplate(t *testing.T) {
+	data := jpegWithOrientation(t, quadrants(400, 200), 6, binary.BigEndian)
+
+	master, format, err := normalizeTemplate(data, TemplateOptions{
+		Crop:         image.Rect(0, 0, 200, 300),
+		MaxDimension: 150,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != "jpeg" {
+		t.Errorf("format is %s, want jpeg", format)
+	}
+
+	// upright image is 200x400, cropped to 200x300 and scaled to 100x150
+	if size := master.Bounds().Size(); size != image.Pt(100, 150) {
+		t.Errorf("master size is %v, want 100x150", size)
+	}
+
+	if _, _, err := normalizeTemplate(data, TemplateOptions{Crop: image.Rect(100, 100, 300, 300)}); err != errCropOutside {
+		t.Errorf("crop outside of template returned %v, want %v", err, errCropOutside)
+	}
+
+	if _, _, err := normalizeTemplate([]byte("not an image"), TemplateOptions{}); err != errUnsupportedImage {
+		t.Errorf("invalid file returned %v, want %v", err, errUnsupportedImage)
+	}
+
+	if _, _, err := normalizeTemplate(pngHeader(10000, 6000), TemplateOptions{}); err != errTemplateTooLarge {
+		t.Errorf("60 megapixel template returned %v, want %v", err, errTemplateTooLarge)
+	}
+}
+
+// pngHeader returns PNG signature and header of image with given size
+// without any pixel data.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 2 // truecolor
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)-4))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+
+	return buf.Bytes()
+}
@@ -0,0 +1,144 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// quantizeSamples is approximate number of pixels palette is computed from.
+const quantizeSamples = 1 << 16
+
+// colorBox is set of colors split by median cut.
+type colorBox []color.RGBA
+
+// channel returns value of channel with index 0 to 3 for red, green, blue
+// and alpha.
+func channel(c color.RGBA, i int) uint8 {
+	switch i {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	case 2:
+		return c.B
+	}
+
+	return c.A
+}
+
+// widest returns index of channel with the largest range of values and the
+// range.
+func (b colorBox) widest() (int, int) {
+	best, bestRange := 0, -1
+	for i := 0; i < 4; i++ {
+		min, max := uint8(math.MaxUint8), uint8(0)
+		for _, c := range b {
+			v := channel(c, i)
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+
+		if r := int(max) - int(min); r > bestRange {
+			best, bestRange = i, r
+		}
+	}
+
+	return best, bestRange
+}
+
+// mean returns average color of box.
+func (b colorBox) mean() color.RGBA {
+	var sum [4]int
+	for _, c := range b {
+		sum[0] += int(c.R)
+		sum[1] += int(c.G)
+		sum[2] += int(c.B)
+		sum[3] += int(c.A)
+	}
+
+	n := len(b)
+	return color.RGBA{
+		R: uint8(sum[0] / n),
+		G: uint8(sum[1] / n),
+		B: uint8(sum[2] / n),
+		A: uint8(sum[3] / n),
+	}
+}
+
+// medianCutPalette returns palette of at most n colors for image. Colors are
+// sampled in regular grid and the box with the widest channel is split at
+// its median until there are n boxes, palette holds their average colors.
+func medianCutPalette(img image.Image, n int) color.Palette {
+	if n < 1 {
+		n = 1
+	}
+
+	bounds := img.Bounds()
+	step := int(math.Sqrt(float64(bounds.Dx()*bounds.Dy()) / quantizeSamples))
+	if step < 1 {
+		step = 1
+	}
+
+	var samples colorBox
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			samples = append(samples, color.RGBAModel.Convert(img.At(x, y)).(color.RGBA))
+		}
+	}
+
+	if len(samples) == 0 {
+		return color.Palette{color.Transparent}
+	}
+
+	boxes := []colorBox{samples}
+	for len(boxes) < n {
+		split, channelIndex, splitRange := -1, 0, 0
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+
+			if ci, r := b.widest(); r > splitRange {
+				split, channelIndex, splitRange = i, ci, r
+			}
+		}
+
+		// every box has single color
+		if split < 0 {
+			break
+		}
+
+		b := boxes[split]
+		sort.Slice(b, func(i, j int) bool {
+			return channel(b[i], channelIndex) < channel(b[j], channelIndex)
+		})
+
+		// equal values stay in one box, so boxes never share a color
+		median := len(b) / 2
+		v := channel(b[median], channelIndex)
+		for median > 0 && channel(b[median-1], channelIndex) == v {
+			median--
+		}
+		if median == 0 {
+			for median < len(b) && channel(b[median], channelIndex) == v {
+				median++
+			}
+		}
+
+		boxes[split] = b[:median]
+		boxes = append(boxes, b[median:])
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		palette[i] = b.mean()
+	}
+
+	return palette
+}
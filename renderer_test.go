@@ -0,0 +1,124 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// testTemplate creates gradient template of given size.
+func testTemplate(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: 128,
+				A: 255,
+			})
+		}
+	}
+
+	return img
+}
+
+// BenchmarkRenderParseFontEachTime renders meme the way worker used to, font
+// is parsed and glyphs are rasterized again for every render.
+func BenchmarkRenderParseFontEachTime(b *testing.B) {
+	src := testTemplate(600, 400)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := truetype.Parse(WorkerFontBytes)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		r, err := NewRenderer(WithFonts(f))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := r.Render(src, "ONE DOES NOT SIMPLY", "RENDER A MEME"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRenderCachedFont renders meme with font from registry and pooled faces.
+func BenchmarkRenderCachedFont(b *testing.B) {
+	src := testTemplate(600, 400)
+	f, _ := Fonts.Font(DefaultFontID)
+
+	r, err := NewRenderer(WithFonts(f))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Render(src, "ONE DOES NOT SIMPLY", "RENDER A MEME"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRenderCachedFontParallel renders memes from many goroutines sharing
+// font and face cache.
+func BenchmarkRenderCachedFontParallel(b *testing.B) {
+	src := testTemplate(600, 400)
+	f, _ := Fonts.Font(DefaultFontID)
+
+	r, err := NewRenderer(WithFonts(f))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := r.Render(src, "ONE DOES NOT SIMPLY", "RENDER A MEME"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkRenderMeme renders meme with compatibility wrapper.
+func BenchmarkRenderMeme(b *testing.B) {
+	src := testTemplate(600, 400)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := RenderMeme(WorkerFontBytes, src, "ONE DOES NOT SIMPLY", "RENDER A MEME"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRenderEmptyImage(t *testing.T) {
+	// output size with single dimension scales by source aspect ratio
+	for _, out := range []image.Point{{200, 0}, {0, 200}} {
+		r := testRenderer(t, WithOutputSize(out.X, out.Y))
+
+		for _, size := range []image.Point{{0, 0}, {100, 0}, {0, 100}} {
+			src := testTemplate(size.X, size.Y)
+
+			if _, err := r.RenderCaptions(src, Caption{Text: "TOP"}, Caption{}); err != ErrEmptyImage {
+				t.Errorf("rendering %v image at %v returned %v, want %v", size, out, err, ErrEmptyImage)
+			}
+
+			if err := r.RenderSVG(ioutil.Discard, src, Caption{Text: "TOP"}, Caption{}); err != ErrEmptyImage {
+				t.Errorf("rendering %v image at %v as SVG returned %v, want %v", size, out, err, ErrEmptyImage)
+			}
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package memecreator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/file"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/user"
+)
+
+const (
+	// StickerKind is the name of kind in Datastore.
+	StickerKind = "Sticker"
+
+	// StickerObjectPrefix is prefix of cloud storage objects with stickers.
+	StickerObjectPrefix = "stickers/"
+
+	// MaxOverlays is maximum number of overlays of single meme.
+	MaxOverlays = 20
+
+	// DefaultOverlayScale is width of overlay relative to template when no
+	// scale is given.
+	DefaultOverlayScale = 0.25
+)
+
+// Sticker is type used for storing details about image placed over
+// templates. Private stickers are user-provided images, e.g. faces, which
+// are used only by memes referencing them and are not listed.
+type Sticker struct {
+	Created  time.Time `json:"created"`
+	Filename string    `json:"filename"`
+	Private  bool      `json:"private"`
+}
+
+// StickerResponse is type returned as response from API.
+type StickerResponse struct {
+	ID string `json:"id"`
+	Sticker
+}
+
+// OverlaySpec is type used for storing sticker placed over meme template.
+// Position is center of sticker relative to template size, scale is its
+// width relative to template width, rotation is clockwise in degrees and
+// opacity is from 0 to 1. Zero scale and opacity use defaults.
+type OverlaySpec struct {
+	StickerID string  `json:"sticker_id"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Scale     float64 `json:"scale,omitempty"`
+	Rotation  float64 `json:"rotation,omitempty"`
+	Opacity   float64 `json:"opacity,omitempty"`
+}
+
+// StickersHandler handles actions getting stickers or uploading new sticker.
+func StickersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		GetStickersHandler(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	PostStickersHandler(w, r)
+}
+
+// GetStickersHandler handles getting public stickers.
+func GetStickersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	var stickers []*StickerResponse
+	keys, err := datastore.NewQuery(StickerKind).
+		Order("-Created").
+		GetAll(ctx, &stickers)
+	if err != nil {
+		log.Errorf(ctx, "fetching stickers from datastore failed, error %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	publicStickers := make([]*StickerResponse, 0, len(stickers))
+	for i, s := range stickers {
+		if s.Private {
+			continue
+		}
+
+		s.ID = keys[i].Encode()
+		publicStickers = append(publicStickers, s)
+	}
+
+	resp := map[string]interface{}{
+		"stickers": publicStickers,
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf(ctx, "encoding stickers failed, error %s", err)
+		writeInternalError(w, r)
+		return
+	}
+}
+
+// PostStickersHandler handles uploading new sticker, stickers uploaded with
+// private form value are not listed and are used for user-provided faces.
+// Public stickers are listed to everyone, so only admins can upload them.
+func PostStickersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := appengine.NewContext(r)
+
+	if !parseMultipartForm(ctx, w, r, MaxTemplateSize, ErrorCodeStickerTooLarge, "sticker is too large") {
+		return
+	}
+
+	private := r.FormValue("private") == "true"
+	if !private && !user.IsAdmin(ctx) {
+		writeError(w, r, http.StatusForbidden, ErrorCodeForbidden, "only admins can upload public stickers")
+		return
+	}
+
+	stickerFile, stickerHandler, err := r.FormFile("sticker")
+	if err != nil {
+		log.Errorf(ctx, "getting multipart form sticker object failed, error: %s", err)
+		writeError(w, r, http.StatusBadRequest, ErrorCodeMissingStickerFile, "missing sticker file in request")
+		return
+	}
+	defer stickerFile.Close()
+
+	stickerBytes, err := ioutil.ReadAll(stickerFile)
+	if err != nil {
+		log.Errorf(ctx, "reading sticker file failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	if _, _, err := image.DecodeConfig(bytes.NewReader(stickerBytes)); err != nil {
+		writeAPIError(w, r, &APIError{
+			Status:  http.StatusBadRequest,
+			Code:    ErrorCodeValidationFailed,
+			Message: "sticker is invalid",
+			Details: []*ValidationError{{
+				Field:   "sticker",
+				Message: "sticker file is not supported image",
+			}},
+		})
+		return
+	}
+
+	filename := stickerObjectName(stickerHandler.Filename, private, time.Now())
+
+	storageClient, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Errorf(ctx, "getting storage client failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	bucketName, err := file.DefaultBucketName(ctx)
+	if err != nil {
+		log.Errorf(ctx, "getting storage bucket name failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	if err := writeTemplateObject(ctx, storageClient.Bucket(bucketName), filename, !private, func(w io.Writer) error {
+		_, err := w.Write(stickerBytes)
+		return err
+	}); err != nil {
+		log.Errorf(ctx, "storing sticker failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	sticker := Sticker{
+		Created:  time.Now(),
+		Filename: filename,
+		Private:  private,
+	}
+	stickerKey, err := datastore.Put(
+		ctx,
+		datastore.NewIncompleteKey(ctx, StickerKind, nil),
+		&sticker,
+	)
+	if err != nil {
+		log.Errorf(ctx, "storing sticker in datastore failed, error: %s", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"sticker": &StickerResponse{
+			ID:      stickerKey.Encode(),
+			Sticker: sticker,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorf(ctx, "encoding sticker failed, error %s", err)
+		return
+	}
+}
+
+// stickerObjectName returns name of cloud storage object for uploaded
+// sticker file. Names are prefixed with upload time, so stickers uploaded
+// with the same file name don't overwrite each other.
+func stickerObjectName(name string, private bool, now time.Time) string {
+	prefix := StickerObjectPrefix
+	if private {
+		prefix += "private/"
+	}
+
+	return fmt.Sprintf("%s%d-%s", prefix, now.UnixNano(), path.Base(name))
+}
+
+// validateOverlays checks that overlays have valid sticker ids and their
+// placement is within limits. Existence of stickers is not checked.
+func validateOverlays(overlays []OverlaySpec) []*ValidationError {
+	var errs []*ValidationError
+	for i, o := range overlays {
+		if stickerKey, err := datastore.DecodeKey(o.StickerID); err != nil || stickerKey.Kind() != StickerKind {
+			errs = append(errs, &ValidationError{
+				Field:   fmt.Sprintf("overlays[%d].sticker_id", i),
+				Message: "sticker id is invalid",
+			})
+		}
+	}
+
+	return append(errs, validateOverlayPlacement(overlays)...)
+}
+
+// validateOverlayPlacement checks that number of overlays and their
+// placement are within limits, e.g. for overlays of local stickers.
+func validateOverlayPlacement(overlays []OverlaySpec) []*ValidationError {
+	var errs []*ValidationError
+
+	if len(overlays) > MaxOverlays {
+		errs = append(errs, &ValidationError{
+			Field:   "overlays",
+			Message: fmt.Sprintf("meme can have at most %d overlays", MaxOverlays),
+		})
+	}
+
+	for i, o := range overlays {
+		field := fmt.Sprintf("overlays[%d]", i)
+
+		// overlays may stick out of template, but their center not too far
+		if !(o.X >= -1 && o.X <= 2 && o.Y >= -1 && o.Y <= 2) {
+			errs = append(errs, &ValidationError{
+				Field:   field,
+				Message: "position must be between -1 and 2",
+			})
+		}
+
+		if !(o.Scale >= 0 && o.Scale <= 4) {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".scale",
+				Message: "scale must be between 0 and 4",
+			})
+		}
+
+		if !(o.Rotation >= -360 && o.Rotation <= 360) {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".rotation",
+				Message: "rotation must be between -360 and 360 degrees",
+			})
+		}
+
+		if !(o.Opacity >= 0 && o.Opacity <= 1) {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".opacity",
+				Message: "opacity must be between 0 and 1",
+			})
+		}
+	}
+
+	return errs
+}
+
+// loadOverlays returns renderer overlays of specs with defaults filled in,
+// sticker images are loaded by load once for every sticker id.
+func loadOverlays(specs []OverlaySpec, load func(stickerID string) (image.Image, error)) ([]Overlay, error) {
+	images := make(map[string]image.Image)
+	overlays := make([]Overlay, 0, len(specs))
+	for _, spec := range specs {
+		img, ok := images[spec.StickerID]
+		if !ok {
+			var err error
+			if img, err = load(spec.StickerID); err != nil {
+				return nil, err
+			}
+			images[spec.StickerID] = img
+		}
+
+		o := Overlay{
+			Image:    img,
+			X:        spec.X,
+			Y:        spec.Y,
+			Scale:    spec.Scale,
+			Rotation: spec.Rotation,
+			Opacity:  spec.Opacity,
+		}
+		if o.Scale == 0 {
+			o.Scale = DefaultOverlayScale
+		}
+		if o.Opacity == 0 {
+			o.Opacity = 1
+		}
+
+		overlays = append(overlays, o)
+	}
+
+	return overlays, nil
+}
+
+// loadSticker gets sticker from datastore and decodes its image.
+func loadSticker(ctx context.Context, bucket *storage.BucketHandle, stickerID string) (image.Image, error) {
+	stickerKey, err := datastore.DecodeKey(stickerID)
+	if err != nil {
+		return nil, fmt.Errorf("decoding sticker key failed, error: %s", err)
+	}
+
+	var sticker Sticker
+	if err := datastore.Get(
+		ctx,
+		stickerKey,
+		&sticker,
+	); err != nil {
+		return nil, fmt.Errorf("getting sticker %s from datastore failed, error: %s", stickerID, err)
+	}
+
+	stickerReader, err := bucket.Object(sticker.Filename).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting storage object failed, error: %s", err)
+	}
+	defer stickerReader.Close()
+
+	img, _, err := image.Decode(stickerReader)
+	if err != nil {
+		return nil, fmt.Errorf("decoding sticker image failed, error: %s", err)
+	}
+
+	return img, nil
+}
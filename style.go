@@ -0,0 +1,223 @@
+package memecreator
+
+import (
+	"fmt"
+	"image/color"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	// MinLetterSpacing and MaxLetterSpacing limit caption letter spacing
+	// in ems.
+	MinLetterSpacing = -0.5
+	MaxLetterSpacing = 2
+)
+
+// textTransforms maps transform names used in API to renderer transforms.
+var textTransforms = map[string]TextTransform{
+	"none":       TransformNone,
+	"uppercase":  TransformUppercase,
+	"title":      TransformTitle,
+	"small_caps": TransformSmallCaps,
+}
+
+// layoutModes maps layout names used in API to renderer layout modes.
+var layoutModes = map[string]LayoutMode{
+	"overlay": LayoutOverlay,
+	"bands":   LayoutBands,
+}
+
+// ColorAuto is caption color contrasting with template under caption. It is
+// used for captions without color set by template nor meme.
+const ColorAuto = "auto"
+
+// CaptionStyle is type used for storing style of single caption box. Meme
+// styles override template styles field by field, empty fields are
+// inherited and zero letter spacing keeps inherited spacing.
+type CaptionStyle struct {
+	Color         string  `json:"color,omitempty"`
+	Transform     string  `json:"transform,omitempty"`
+	Locale        string  `json:"locale,omitempty"`
+	LetterSpacing float64 `json:"letter_spacing,omitempty"`
+}
+
+// merge returns style with fields set in override replacing fields of s.
+func (s CaptionStyle) merge(override CaptionStyle) CaptionStyle {
+	if override.Color != "" {
+		s.Color = override.Color
+	}
+
+	if override.Transform != "" {
+		s.Transform = override.Transform
+	}
+
+	if override.Locale != "" {
+		s.Locale = override.Locale
+	}
+
+	if override.LetterSpacing != 0 {
+		s.LetterSpacing = override.LetterSpacing
+	}
+
+	return s
+}
+
+// textStyle returns renderer style base changed by caption style. Style is
+// expected to be validated, unknown values are ignored.
+func (s CaptionStyle) textStyle(base TextStyle) TextStyle {
+	if s.Color == "" || s.Color == ColorAuto {
+		base.AutoColor = true
+	} else if c, ok := parseColor(s.Color); ok {
+		base.Color = c
+		base.AutoColor = false
+	}
+
+	if transform, ok := textTransforms[s.Transform]; ok {
+		base.Transform = transform
+	}
+
+	if lang, err := language.Parse(s.Locale); err == nil {
+		base.Language = lang
+	}
+
+	base.LetterSpacing = s.LetterSpacing
+
+	return base
+}
+
+// captionStyleFromForm creates caption style from form values with field
+// names prefixed by caption name, e.g. top_transform.
+func captionStyleFromForm(form url.Values, caption string) (CaptionStyle, error) {
+	s := CaptionStyle{
+		Color:     form.Get(caption + "_color"),
+		Transform: form.Get(caption + "_transform"),
+		Locale:    form.Get(caption + "_locale"),
+	}
+
+	if spacing := form.Get(caption + "_letter_spacing"); spacing != "" {
+		v, err := strconv.ParseFloat(spacing, 64)
+		if err != nil {
+			return s, fmt.Errorf("parsing %s letter spacing failed, error: %s", caption, err)
+		}
+		s.LetterSpacing = v
+	}
+
+	return s, nil
+}
+
+// parseColor parses white, black or hex color in #rgb or #rrggbb form.
+func parseColor(s string) (color.Color, bool) {
+	switch s {
+	case "white":
+		return color.White, true
+	case "black":
+		return color.Black, true
+	}
+
+	if !strings.HasPrefix(s, "#") || len(s) != 4 && len(s) != 7 {
+		return nil, false
+	}
+
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return nil, false
+	}
+
+	if len(s) == 4 {
+		// #rgb repeats every digit, e.g. #fc0 is #ffcc00
+		return color.NRGBA{
+			R: uint8(v>>8&0xf) * 0x11,
+			G: uint8(v>>4&0xf) * 0x11,
+			B: uint8(v&0xf) * 0x11,
+			A: 0xff,
+		}, true
+	}
+
+	return color.NRGBA{
+		R: uint8(v >> 16),
+		G: uint8(v >> 8),
+		B: uint8(v),
+		A: 0xff,
+	}, true
+}
+
+// validateCaptionStyle checks that style of caption given by field uses
+// known color and transform, valid locale and letter spacing within limits.
+func validateCaptionStyle(field string, s CaptionStyle) []*ValidationError {
+	var errs []*ValidationError
+
+	if _, ok := parseColor(s.Color); s.Color != "" && s.Color != ColorAuto && !ok {
+		errs = append(errs, &ValidationError{
+			Field:   field + ".color",
+			Message: "color must be auto, white, black or hex color like #ffcc00",
+		})
+	}
+
+	if _, ok := textTransforms[s.Transform]; s.Transform != "" && !ok {
+		errs = append(errs, &ValidationError{
+			Field:   field + ".transform",
+			Message: "transform must be one of none, uppercase, title or small_caps",
+		})
+	}
+
+	if s.Locale != "" {
+		if _, err := language.Parse(s.Locale); err != nil {
+			errs = append(errs, &ValidationError{
+				Field:   field + ".locale",
+				Message: "locale is not valid BCP 47 language tag",
+			})
+		}
+	}
+
+	if !(s.LetterSpacing >= MinLetterSpacing && s.LetterSpacing <= MaxLetterSpacing) {
+		errs = append(errs, &ValidationError{
+			Field:   field + ".letter_spacing",
+			Message: fmt.Sprintf("letter spacing must be between %v and %v em", MinLetterSpacing, MaxLetterSpacing),
+		})
+	}
+
+	return errs
+}
+
+// validateLayout checks that meme uses known layout and valid band color.
+func validateLayout(cmd *CreateMemeCommand) []*ValidationError {
+	var errs []*ValidationError
+
+	if _, ok := layoutModes[cmd.Layout]; cmd.Layout != "" && !ok {
+		errs = append(errs, &ValidationError{
+			Field:   "layout",
+			Message: "layout must be one of overlay or bands",
+		})
+	}
+
+	if _, ok := parseColor(cmd.BandColor); cmd.BandColor != "" && !ok {
+		errs = append(errs, &ValidationError{
+			Field:   "band_color",
+			Message: "band color must be white, black or hex color like #ffcc00",
+		})
+	}
+
+	return errs
+}
+
+// renderOptions returns renderer options selecting layout, effects and text
+// boxes of meme.
+func (m *Meme) renderOptions() []RenderOption {
+	opts := []RenderOption{
+		renderEffects(m.Effects),
+		WithTextBoxes(textBoxes(m.TextBoxes, DefaultRenderOptions().Style)...),
+	}
+	if layout, ok := layoutModes[m.Layout]; ok {
+		opts = append(opts, WithLayout(layout))
+	}
+
+	if c, ok := parseColor(m.BandColor); ok {
+		opts = append(opts, WithBandColor(c))
+	}
+
+	return opts
+}
@@ -0,0 +1,50 @@
+package memecreator
+
+import (
+	"image/color"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestCaptionStyleMerge(t *testing.T) {
+	template := CaptionStyle{Transform: "uppercase", Locale: "tr", LetterSpacing: 0.1}
+
+	s := template.merge(CaptionStyle{Transform: "none"})
+	if s.Transform != "none" || s.Locale != "tr" || s.LetterSpacing != 0.1 {
+		t.Errorf("merged style is %+v, want template style with transform none", s)
+	}
+
+	ts := s.textStyle(DefaultRenderOptions().Style)
+	if ts.Transform != TransformNone || ts.Language != language.Turkish || ts.LetterSpacing != 0.1 {
+		t.Errorf("text style is %+v", ts)
+	}
+
+	// captions without color contrast with template
+	if !ts.AutoColor {
+		t.Errorf("style without color doesn't use auto color")
+	}
+
+	if ts := (CaptionStyle{Color: "#fc0"}).textStyle(DefaultRenderOptions().Style); ts.AutoColor || ts.Color != (color.NRGBA{R: 0xff, G: 0xcc, A: 0xff}) {
+		t.Errorf("style with color is %+v", ts)
+	}
+}
+
+func TestValidateCaptionStyle(t *testing.T) {
+	for _, tt := range []struct {
+		style CaptionStyle
+		errs  int
+	}{
+		{CaptionStyle{}, 0},
+		{CaptionStyle{Transform: "small_caps", Locale: "de-CH", LetterSpacing: -0.2}, 0},
+		{CaptionStyle{Color: "#ffcc00"}, 0},
+		{CaptionStyle{Color: "ffcc00"}, 1},
+		{CaptionStyle{Transform: "shouting"}, 1},
+		{CaptionStyle{Locale: "not a locale"}, 1},
+		{CaptionStyle{LetterSpacing: 3}, 1},
+	} {
+		if errs := validateCaptionStyle("top_style", tt.style); len(errs) != tt.errs {
+			t.Errorf("style %+v has %d errors, want %d", tt.style, len(errs), tt.errs)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package memecreator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"image/color"
+	"image/png"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// svgDocument is part of rendered SVG checked by tests.
+type svgDocument struct {
+	Width  int `xml:"width,attr"`
+	Height int `xml:"height,attr"`
+	Rects  []struct {
+		Fill string `xml:"fill,attr"`
+	} `xml:"rect"`
+	Images []struct {
+		Y    int    `xml:"y,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"image"`
+	Texts []struct {
+		FontFamily string   `xml:"font-family,attr"`
+		Fill       string   `xml:"fill,attr"`
+		Stroke     string   `xml:"stroke,attr"`
+		Spans      []string `xml:"tspan"`
+	} `xml:"text"`
+}
+
+func renderTestSVG(t *testing.T, r *Renderer, top, bottom Caption) svgDocument {
+	var buf bytes.Buffer
+	if err := r.RenderSVG(&buf, testTemplate(400, 300), top, bottom); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc svgDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("parsing svg failed, error: %s", err)
+	}
+
+	return doc
+}
+
+func TestRenderSVG(t *testing.T) {
+	r := testRenderer(t)
+	doc := renderTestSVG(t, r,
+		Caption{Text: "TOP & <TEXT>", Style: TextStyle{Color: color.White, OutlineColor: color.Black, OutlineWidth: 2}},
+		Caption{Text: "BOTTOM", Style: TextStyle{Color: color.Black}},
+	)
+
+	if doc.Width != 400 || doc.Height != 300 {
+		t.Errorf("svg is %dx%d, want 400x300", doc.Width, doc.Height)
+	}
+
+	if len(doc.Images) != 1 || !strings.HasPrefix(doc.Images[0].Href, "data:image/png;base64,") {
+		t.Fatalf("svg has no embedded png template")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(doc.Images[0].Href, "data:image/png;base64,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, err := png.Decode(bytes.NewReader(data)); err != nil || img.Bounds().Dx() != 400 {
+		t.Errorf("embedded template is not 400 pixels wide png, error: %v", err)
+	}
+
+	if len(doc.Texts) != 2 {
+		t.Fatalf("svg has %d text elements, want 2", len(doc.Texts))
+	}
+
+	if got := strings.Join(doc.Texts[0].Spans, ""); got != "TOP & <TEXT>" {
+		t.Errorf("top caption is %q, want escaped text unchanged", got)
+	}
+
+	if doc.Texts[0].Fill != "#ffffff" || doc.Texts[0].Stroke != "#000000" {
+		t.Errorf("top caption has fill %q and stroke %q, want white with black outline", doc.Texts[0].Fill, doc.Texts[0].Stroke)
+	}
+
+	if doc.Texts[1].Stroke != "" {
+		t.Errorf("bottom caption without outline has stroke %q", doc.Texts[1].Stroke)
+	}
+
+	if !strings.HasSuffix(doc.Texts[0].FontFamily, "sans-serif") {
+		t.Errorf("font family %q has no generic fallback", doc.Texts[0].FontFamily)
+	}
+}
+
+func TestRenderSVGBands(t *testing.T) {
+	r := testRenderer(t, WithLayout(LayoutBands), WithBandColor(color.Black))
+	doc := renderTestSVG(t, r, Caption{Text: "TOP", Style: TextStyle{Color: color.White}}, Caption{})
+
+	if len(doc.Rects) != 1 || doc.Rects[0].Fill != "#000000" {
+		t.Errorf("svg has no black band background")
+	}
+
+	if len(doc.Images) != 1 || doc.Images[0].Y <= 0 || doc.Height <= 300 {
+		t.Errorf("template is not placed below top band")
+	}
+}
+
+func TestFormatFromQuery(t *testing.T) {
+	cmds := []*CreateMemeCommand{{Output: OutputFormat{Format: FormatJPEG}}, nil}
+
+	formatFromQuery(httptest.NewRequest("POST", "/memes:batch", nil), cmds...)
+	if cmds[0].Output.Format != FormatJPEG {
+		t.Errorf("format without query is %q, want %q", cmds[0].Output.Format, FormatJPEG)
+	}
+
+	formatFromQuery(httptest.NewRequest("POST", "/memes:batch?format=svg", nil), cmds...)
+	if cmds[0].Output.Format != FormatSVG {
+		t.Errorf("format with query is %q, want %q", cmds[0].Output.Format, FormatSVG)
+	}
+}
+
+func TestValidateSVGEffects(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		format  string
+		effects []EffectSpec
+		fields  []string
+	}{
+		{"png with after effect", FormatPNG, []EffectSpec{{Name: "blur"}}, nil},
+		{"svg with before effect", FormatSVG, []EffectSpec{{Name: "blur", Stage: EffectStageBefore}}, nil},
+		{"svg with default stage", FormatSVG, []EffectSpec{{Name: "grayscale", Stage: EffectStageBefore}, {Name: "blur"}}, []string{"effects[1].stage"}},
+		{"svg with after effect", FormatSVG, []EffectSpec{{Name: "jpeg", Stage: EffectStageAfter}}, []string{"effects[0].stage"}},
+	} {
+		errs := validateSVGEffects(&CreateMemeCommand{
+			Output:  OutputFormat{Format: tt.format},
+			Effects: tt.effects,
+		})
+
+		var fields []string
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: errors of fields %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
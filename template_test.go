@@ -0,0 +1,29 @@
+package memecreator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTemplateHandler(t *testing.T) {
+	for _, tt := range []struct {
+		method string
+		id     string
+		status int
+		code   string
+	}{
+		// deleting needs admin, test requests have no user
+		{http.MethodDelete, testTemplateID, http.StatusForbidden, ErrorCodeForbidden},
+		{http.MethodDelete, "drake", http.StatusForbidden, ErrorCodeForbidden},
+		{http.MethodGet, "drake", http.StatusNotFound, ErrorCodeNotFound},
+		{http.MethodPut, testTemplateID, http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		TemplateHandler(w, httptest.NewRequest(tt.method, "/templates/"+tt.id, nil))
+
+		if apiErr := decodeAPIError(t, w); w.Code != tt.status || apiErr.Code != tt.code {
+			t.Errorf("%s %s has status %d and code %q, want %d and %q", tt.method, tt.id, w.Code, apiErr.Code, tt.status, tt.code)
+		}
+	}
+}
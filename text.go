@@ -0,0 +1,145 @@
+package memecreator
+
+import (
+	"image"
+	"unicode"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/text/cases"
+)
+
+// BitmapFallback provides bitmap glyphs for runes missing in all fonts of
+// renderer, typically color emoji.
+type BitmapFallback interface {
+	Glyph(r rune) (image.Image, bool)
+}
+
+// SpriteSheet is bitmap fallback reading glyphs from grid of square cells in
+// single image, cells are assigned to runes row by row.
+type SpriteSheet struct {
+	img      image.Image
+	cellSize int
+	cells    map[rune]int
+}
+
+// NewSpriteSheet creates sprite sheet with cells of cellSize pixels holding
+// glyphs of given runes in the same order.
+func NewSpriteSheet(img image.Image, cellSize int, runes []rune) *SpriteSheet {
+	cells := make(map[rune]int, len(runes))
+	for i, r := range runes {
+		cells[r] = i
+	}
+
+	return &SpriteSheet{
+		img:      img,
+		cellSize: cellSize,
+		cells:    cells,
+	}
+}
+
+// Glyph returns image of rune glyph.
+func (s *SpriteSheet) Glyph(r rune) (image.Image, bool) {
+	i, ok := s.cells[r]
+	if !ok || s.cellSize <= 0 {
+		return nil, false
+	}
+
+	bounds := s.img.Bounds()
+	columns := bounds.Dx() / s.cellSize
+	if columns == 0 {
+		return nil, false
+	}
+
+	min := bounds.Min.Add(image.Pt(i%columns*s.cellSize, i/columns*s.cellSize))
+	cell := image.Rectangle{Min: min, Max: min.Add(image.Pt(s.cellSize, s.cellSize))}
+	if !cell.In(bounds) {
+		return nil, false
+	}
+
+	sub, ok := s.img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, false
+	}
+
+	return sub.SubImage(cell), true
+}
+
+// smallCapsScale is size of small capitals relative to caption font size.
+const smallCapsScale = 0.75
+
+// textRun is part of text drawn with single font or single bitmap glyph.
+type textRun struct {
+	text   string
+	font   *truetype.Font
+	bitmap image.Image
+
+	// small runs are lower case letters drawn as smaller capitals
+	small bool
+}
+
+// fontSize returns size run is drawn at in caption of given size.
+func (run *textRun) fontSize(size float64) float64 {
+	if run.small {
+		return size * smallCapsScale
+	}
+
+	return size
+}
+
+// glyphFont returns first font in set having glyph for rune.
+func (fs FontSet) glyphFont(r rune) (*truetype.Font, bool) {
+	for _, f := range fs {
+		if f != nil && f.Index(r) != 0 {
+			return f, true
+		}
+	}
+
+	return nil, false
+}
+
+// textRuns splits text into runs drawn with the same font. Every rune uses
+// the first font having its glyph, then bitmap fallback and finally primary
+// font which draws missing glyph box. With small caps lower case letters are
+// upper cased by caser into separate small runs.
+func (r *Renderer) textRuns(text string, smallCaps *cases.Caser) []textRun {
+	var runs []textRun
+
+	for _, c := range text {
+		small := false
+		if smallCaps != nil && unicode.IsLower(c) {
+			upper := []rune(smallCaps.String(string(c)))
+			if len(upper) == 1 {
+				c, small = upper[0], true
+			}
+		}
+
+		// joiners and variation selectors only change look of emoji
+		// sequences, no font draws them on their own
+		if c == '\u200d' || unicode.Is(unicode.Variation_Selector, c) {
+			continue
+		}
+
+		f, ok := r.opts.Fonts.glyphFont(c)
+		if !ok && r.opts.Bitmaps != nil {
+			if glyph, ok := r.opts.Bitmaps.Glyph(c); ok {
+				runs = append(runs, textRun{text: string(c), bitmap: glyph, small: small})
+				continue
+			}
+		}
+
+		if !ok {
+			f = r.opts.Fonts[0]
+		}
+
+		if n := len(runs); n > 0 && runs[n-1].font == f && runs[n-1].small == small {
+			runs[n-1].text += string(c)
+			continue
+		}
+
+		runs = append(runs, textRun{text: string(c), font: f, small: small})
+	}
+
+	return runs
+}
@@ -0,0 +1,47 @@
+package memecreator
+
+import (
+	"testing"
+
+	"golang.org/x/image/math/fixed"
+)
+
+func TestTextRunsFallback(t *testing.T) {
+	primary, _ := Fonts.Font(DefaultFontID)
+	fallback, _ := Fonts.Font("go-regular")
+	r := testRenderer(t, WithFonts(primary, fallback))
+
+	// Ǎ is only in fallback font, snowman is in none and is drawn by primary
+	// font as missing glyph box
+	runs := r.textRuns("HI ǍЖУК☃", nil)
+
+	want := []textRun{
+		{text: "HI ", font: primary},
+		{text: "Ǎ", font: fallback},
+		{text: "ЖУК☃", font: primary},
+	}
+	if len(runs) != len(want) {
+		t.Fatalf("text has %d runs %+v, want %d", len(runs), runs, len(want))
+	}
+
+	var sum fixed.Int26_6
+	for i, run := range runs {
+		if run.text != want[i].text {
+			t.Errorf("run %d is %q, want %q", i, run.text, want[i].text)
+		}
+
+		if run.font != want[i].font {
+			t.Errorf("run %d %q is drawn with wrong font", i, run.text)
+		}
+
+		width := r.measureRuns(runs[i:i+1], 40, 0)
+		if width <= 0 {
+			t.Errorf("run %d %q has width %v, want positive", i, run.text, width)
+		}
+		sum += width
+	}
+
+	if width := r.measureRuns(runs, 40, 0); width != sum {
+		t.Errorf("text width is %v, want %v as sum of runs", width, sum)
+	}
+}
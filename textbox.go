@@ -0,0 +1,241 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/image/math/f64"
+)
+
+// TextBox is caption drawn in box placed anywhere over template, e.g. on
+// sign or screen at an angle. Caption is wrapped and fitted into upright
+// box which is then rotated or mapped onto quad.
+type TextBox struct {
+	Caption Caption
+
+	// X and Y are position of box center and Width and Height its size,
+	// all relative to template size.
+	X, Y          float64
+	Width, Height float64
+
+	// Rotation is clockwise rotation in degrees around box center.
+	Rotation float64
+
+	// Quad are corners of box relative to template size in order top left,
+	// top right, bottom right and bottom left, box is drawn in perspective.
+	// Position, size and rotation are ignored for non-zero quads.
+	Quad [4]f64.Vec2
+}
+
+// WithTextBoxes sets captions drawn in boxes over template.
+func WithTextBoxes(boxes ...TextBox) RenderOption {
+	return func(o *RenderOptions) {
+		o.TextBoxes = boxes
+	}
+}
+
+// drawTextBoxes draws text boxes over image in order.
+func (r *Renderer) drawTextBoxes(dst draw.Image) {
+	for _, box := range r.opts.TextBoxes {
+		r.drawTextBox(dst, box)
+	}
+}
+
+// drawTextBox renders caption into upright transparent layer of box size
+// and composites it onto its quad in image.
+func (r *Renderer) drawTextBox(dst draw.Image, box TextBox) {
+	quad := box.pixelQuad(dst.Bounds())
+
+	width := int(math.Max(distance(quad[0], quad[1]), distance(quad[3], quad[2])) + 0.5)
+	height := int(math.Max(distance(quad[0], quad[3]), distance(quad[1], quad[2])) + 0.5)
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	lines := r.layoutBox(box.Caption, width, height)
+	if len(lines) == 0 {
+		return
+	}
+
+	// text color contrasts with template under whole box
+	under := quadBounds(quad)
+	for _, l := range lines {
+		if l.style.AutoColor {
+			r.autoContrast(dst, under, l)
+		}
+	}
+
+	layer := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for _, l := range lines {
+		r.drawRuns(layer, l)
+	}
+
+	drawQuad(dst, layer, quad)
+}
+
+// pixelQuad returns corners of box in pixels of image bounds.
+func (b TextBox) pixelQuad(bounds image.Rectangle) [4]f64.Vec2 {
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	origin := f64.Vec2{float64(bounds.Min.X), float64(bounds.Min.Y)}
+
+	var quad [4]f64.Vec2
+	if b.Quad != quad {
+		for i, p := range b.Quad {
+			quad[i] = f64.Vec2{origin[0] + p[0]*w, origin[1] + p[1]*h}
+		}
+		return quad
+	}
+
+	// corners around center rotated clockwise, y axis points down
+	cx, cy := origin[0]+b.X*w, origin[1]+b.Y*h
+	hw, hh := b.Width*w/2, b.Height*h/2
+	sin, cos := math.Sincos(b.Rotation * math.Pi / 180)
+	for i, c := range [4]f64.Vec2{{-hw, -hh}, {hw, -hh}, {hw, hh}, {-hw, hh}} {
+		quad[i] = f64.Vec2{cx + c[0]*cos - c[1]*sin, cy + c[0]*sin + c[1]*cos}
+	}
+
+	return quad
+}
+
+// distance returns distance of two points.
+func distance(a, b f64.Vec2) float64 {
+	return math.Hypot(b[0]-a[0], b[1]-a[1])
+}
+
+// quadBounds returns smallest rectangle containing quad.
+func quadBounds(quad [4]f64.Vec2) image.Rectangle {
+	minX, minY := quad[0][0], quad[0][1]
+	maxX, maxY := minX, minY
+	for _, p := range quad[1:] {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// squareToQuad returns projective transform mapping unit square onto quad,
+// corners of square in order 0,0, 1,0, 1,1 and 0,1 map to corners of quad.
+// Matrix is in row-major order with last element 1.
+func squareToQuad(q [4]f64.Vec2) [9]float64 {
+	x0, y0, x1, y1 := q[0][0], q[0][1], q[1][0], q[1][1]
+	x2, y2, x3, y3 := q[2][0], q[2][1], q[3][0], q[3][1]
+
+	dx3, dy3 := x0-x1+x2-x3, y0-y1+y2-y3
+	if dx3 == 0 && dy3 == 0 {
+		// parallelogram is affine
+		return [9]float64{
+			x1 - x0, x2 - x1, x0,
+			y1 - y0, y2 - y1, y0,
+			0, 0, 1,
+		}
+	}
+
+	dx1, dy1 := x1-x2, y1-y2
+	dx2, dy2 := x3-x2, y3-y2
+	den := dx1*dy2 - dx2*dy1
+	g := (dx3*dy2 - dx2*dy3) / den
+	h := (dx1*dy3 - dx3*dy1) / den
+
+	return [9]float64{
+		x1 - x0 + g*x1, x3 - x0 + h*x3, x0,
+		y1 - y0 + g*y1, y3 - y0 + h*y3, y0,
+		g, h, 1,
+	}
+}
+
+// invert3 returns inverse of 3x3 matrix in row-major order, singular
+// matrices are reported by false.
+func invert3(m [9]float64) ([9]float64, bool) {
+	a, b, c := m[0], m[1], m[2]
+	d, e, f := m[3], m[4], m[5]
+	g, h, i := m[6], m[7], m[8]
+
+	det := a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+	if math.Abs(det) < 1e-12 {
+		return [9]float64{}, false
+	}
+
+	return [9]float64{
+		(e*i - f*h) / det, (c*h - b*i) / det, (b*f - c*e) / det,
+		(f*g - d*i) / det, (a*i - c*g) / det, (c*d - a*f) / det,
+		(d*h - e*g) / det, (b*g - a*h) / det, (a*e - b*d) / det,
+	}, true
+}
+
+// drawQuad composites layer over image mapped onto quad given in pixels.
+// Every pixel of image within quad is mapped back to layer and sampled
+// bilinearly, so perspective quads are drawn without gaps.
+func drawQuad(dst draw.Image, layer *image.NRGBA, quad [4]f64.Vec2) {
+	inverse, ok := invert3(squareToQuad(quad))
+	if !ok {
+		return
+	}
+
+	w, h := float64(layer.Bounds().Dx()), float64(layer.Bounds().Dy())
+	rect := quadBounds(quad).Intersect(dst.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			z := inverse[6]*px + inverse[7]*py + inverse[8]
+			if z == 0 {
+				continue
+			}
+
+			u := (inverse[0]*px + inverse[1]*py + inverse[2]) / z
+			v := (inverse[3]*px + inverse[4]*py + inverse[5]) / z
+			if u < 0 || u > 1 || v < 0 || v > 1 {
+				continue
+			}
+
+			sr, sg, sb, sa := sampleBilinear(layer, u*w-0.5, v*h-0.5)
+			if sa == 0 {
+				continue
+			}
+
+			// source over with premultiplied colors
+			dr, dg, db, da := dst.At(x, y).RGBA()
+			k := 1 - sa/0xffff
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(sr + float64(dr)*k + 0.5),
+				G: uint16(sg + float64(dg)*k + 0.5),
+				B: uint16(sb + float64(db)*k + 0.5),
+				A: uint16(sa + float64(da)*k + 0.5),
+			})
+		}
+	}
+}
+
+// sampleBilinear returns premultiplied 16-bit color of image interpolated
+// at pixel coordinates, pixels outside of image are transparent.
+func sampleBilinear(img *image.NRGBA, x, y float64) (float64, float64, float64, float64) {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+
+	var r, g, b, a float64
+	for _, s := range [4]struct {
+		dx, dy int
+		weight float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		px, py := int(x0)+s.dx, int(y0)+s.dy
+		if s.weight == 0 || !image.Pt(px, py).In(img.Bounds()) {
+			continue
+		}
+
+		i := img.PixOffset(px, py)
+		pa := float64(img.Pix[i+3]) * 0x101
+		r += float64(img.Pix[i]) * 0x101 * pa / 0xffff * s.weight
+		g += float64(img.Pix[i+1]) * 0x101 * pa / 0xffff * s.weight
+		b += float64(img.Pix[i+2]) * 0x101 * pa / 0xffff * s.weight
+		a += pa * s.weight
+	}
+
+	return r, g, b, a
+}
@@ -0,0 +1,122 @@
+package memecreator
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"golang.org/x/image/math/f64"
+)
+
+// inkBounds returns bounds of pixels differing from uniform background.
+func inkBounds(img image.Image, background color.Color) image.Rectangle {
+	var r image.Rectangle
+	bg := color.NRGBAModel.Convert(background)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.NRGBAModel.Convert(img.At(x, y)) != bg {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return r
+}
+
+func TestSquareToQuad(t *testing.T) {
+	quad := [4]f64.Vec2{{10, 20}, {110, 30}, {100, 90}, {5, 80}}
+	m := squareToQuad(quad)
+
+	for i, corner := range [4]f64.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+		z := m[6]*corner[0] + m[7]*corner[1] + m[8]
+		x := (m[0]*corner[0] + m[1]*corner[1] + m[2]) / z
+		y := (m[3]*corner[0] + m[4]*corner[1] + m[5]) / z
+		if math.Abs(x-quad[i][0]) > 1e-9 || math.Abs(y-quad[i][1]) > 1e-9 {
+			t.Errorf("corner %v maps to %v,%v, want %v", corner, x, y, quad[i])
+		}
+	}
+
+	if _, ok := invert3(m); !ok {
+		t.Errorf("transform of convex quad is singular")
+	}
+}
+
+func TestDrawTextBoxRotation(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		rotation float64
+		tall     bool
+	}{
+		{"upright", 0, false},
+		{"rotated", 90, true},
+	} {
+		r := testRenderer(t, WithTextBoxes(TextBox{
+			Caption: Caption{Text: "SIGN", Style: TextStyle{Color: color.Black}},
+			X:       0.5, Y: 0.5, Width: 0.5, Height: 0.2,
+			Rotation: tt.rotation,
+		}))
+
+		dst := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		r.drawTextBoxes(dst)
+
+		ink := inkBounds(dst, color.White)
+		if ink.Empty() {
+			t.Errorf("%s: nothing is drawn", tt.name)
+			continue
+		}
+
+		// box is 100x40 pixels around center, rotated box is 40x100
+		box := image.Rect(50, 80, 150, 120)
+		if tt.tall {
+			box = image.Rect(80, 50, 120, 150)
+		}
+		if !ink.In(box.Inset(-1)) {
+			t.Errorf("%s: text covers %v outside of box %v", tt.name, ink, box)
+		}
+		if tall := ink.Dy() > ink.Dx(); tall != tt.tall {
+			t.Errorf("%s: text covers %v, want tall %v", tt.name, ink, tt.tall)
+		}
+	}
+}
+
+func TestDrawTextBoxQuad(t *testing.T) {
+	quad := [4]f64.Vec2{{0.1, 0.2}, {0.9, 0.1}, {0.8, 0.6}, {0.2, 0.5}}
+	r := testRenderer(t, WithTextBoxes(TextBox{
+		Caption: Caption{Text: "PERSPECTIVE", Style: TextStyle{Color: color.Black}},
+		Quad:    quad,
+	}))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	r.drawTextBoxes(dst)
+
+	ink := inkBounds(dst, color.White)
+	if ink.Empty() || !ink.In(image.Rect(30, 20, 270, 120)) {
+		t.Errorf("text covers %v, want within quad bounds", ink)
+	}
+}
+
+func TestValidateTextBoxes(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		boxes []TextBoxSpec
+		errs  int
+	}{
+		{"none", nil, 0},
+		{"rotated", []TextBoxSpec{{Text: "sign", X: 0.5, Y: 0.5, Width: 0.3, Height: 0.1, Rotation: -15}}, 0},
+		{"quad", []TextBoxSpec{{Text: "sign", Quad: QuadSpec{Point{0.1, 0.1}, Point{0.9, 0.2}, Point{0.8, 0.9}, Point{0.1, 0.8}}}}, 0},
+		{"empty box", []TextBoxSpec{{Text: "sign", X: 0.5, Y: 0.5}}, 1},
+		{"outside", []TextBoxSpec{{Text: "sign", X: 1.5, Y: 0.5, Width: 0.3, Height: 0.1, Rotation: 400}}, 2},
+		{"counterclockwise quad", []TextBoxSpec{{Text: "sign", Quad: QuadSpec{Point{0.1, 0.1}, Point{0.1, 0.8}, Point{0.8, 0.9}, Point{0.9, 0.2}}}}, 1},
+		{"crossed quad", []TextBoxSpec{{Text: "sign", Quad: QuadSpec{Point{0.1, 0.1}, Point{0.9, 0.1}, Point{0.1, 0.9}, Point{0.9, 0.9}}}}, 1},
+		{"style", []TextBoxSpec{{Text: "sign", Style: CaptionStyle{Color: "pink"}, X: 0.5, Y: 0.5, Width: 0.3, Height: 0.1}}, 1},
+	} {
+		if errs := validateTextBoxes(tt.boxes); len(errs) != tt.errs {
+			t.Errorf("%s: %d errors, want %d", tt.name, len(errs), tt.errs)
+		}
+	}
+}
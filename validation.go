@@ -0,0 +1,323 @@
+package memecreator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	// MaxCaptionLength is maximum number of characters in single caption.
+	MaxCaptionLength = 120
+)
+
+// ValidationError is type describing single invalid field in request.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// memeValidators check fields of create meme command which don't refer to
+// stored entities. API, inline template uploads and local rendering all run
+// them, so they accept the same memes. Overlays are checked by callers,
+// because their sticker ids are datastore keys in API and files locally.
+var memeValidators = []func(cmd *CreateMemeCommand) []*ValidationError{
+	func(cmd *CreateMemeCommand) []*ValidationError {
+		return validateCaptionStyle("top_style", cmd.TopStyle)
+	},
+	func(cmd *CreateMemeCommand) []*ValidationError {
+		return validateCaptionStyle("bottom_style", cmd.BottomStyle)
+	},
+	validateLayout,
+	func(cmd *CreateMemeCommand) []*ValidationError {
+		return validateOutputFormat(cmd.Output)
+	},
+	func(cmd *CreateMemeCommand) []*ValidationError {
+		return validateEffects(cmd.Effects)
+	},
+	validateSVGEffects,
+	func(cmd *CreateMemeCommand) []*ValidationError {
+		return validateTextBoxes(cmd.TextBoxes)
+	},
+	validateVariants,
+	validateContent,
+}
+
+// validateMemeFields runs all meme validators on command.
+func validateMemeFields(cmd *CreateMemeCommand) []*ValidationError {
+	var errs []*ValidationError
+	for _, validate := range memeValidators {
+		errs = append(errs, validate(cmd)...)
+	}
+
+	return errs
+}
+
+// validateContent checks captions of meme, composed memes have templates and
+// captions in panels.
+func validateContent(cmd *CreateMemeCommand) []*ValidationError {
+	if len(cmd.Panels) > 0 || cmd.Composition != "" {
+		return validatePanels(cmd)
+	}
+
+	return validateCaptions(cmd)
+}
+
+// entityReference is stored entity referenced by command with index of the
+// command and field reporting missing entity. Fonts are referenced by id,
+// their keys are created in context when entities are fetched.
+type entityReference struct {
+	key   *datastore.Key
+	id    string
+	cmd   int
+	field string
+}
+
+// memeReferences are all entities referenced by validated commands.
+type memeReferences struct {
+	templates []entityReference
+	fonts     []entityReference
+	stickers  []entityReference
+}
+
+// validateCreateMemeCommands validates commands and checks that all their
+// templates, fonts and stickers exist. Commands uploaded with template file
+// must have no template id or panels. Returned slice contains validation
+// errors for every command, returned error means validation itself failed.
+func validateCreateMemeCommands(ctx context.Context, cmds []*CreateMemeCommand, templateFile bool) ([][]*ValidationError, error) {
+	errs, refs := checkCreateMemeCommands(cmds, templateFile)
+
+	for i := range refs.fonts {
+		refs.fonts[i].key = datastore.NewKey(ctx, FontKind, refs.fonts[i].id, 0, nil)
+	}
+
+	for _, lookup := range []struct {
+		refs    []entityReference
+		dst     interface{}
+		message string
+	}{
+		{refs.templates, make([]Template, len(refs.templates)), "template does not exist"},
+		{refs.fonts, make([]Font, len(refs.fonts)), "font does not exist"},
+		{refs.stickers, make([]Sticker, len(refs.stickers)), "sticker does not exist"},
+	} {
+		keys := make([]*datastore.Key, len(lookup.refs))
+		for i, ref := range lookup.refs {
+			keys[i] = ref.key
+		}
+
+		missing, err := missingEntities(ctx, keys, lookup.dst)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range missing {
+			ref := lookup.refs[i]
+			errs[ref.cmd] = append(errs[ref.cmd], &ValidationError{
+				Field:   ref.field,
+				Message: lookup.message,
+			})
+		}
+	}
+
+	return errs, nil
+}
+
+// checkCreateMemeCommands validates fields and ids of commands without
+// accessing datastore and returns entities whose existence must be checked.
+func checkCreateMemeCommands(cmds []*CreateMemeCommand, templateFile bool) ([][]*ValidationError, memeReferences) {
+	errs := make([][]*ValidationError, len(cmds))
+
+	var refs memeReferences
+	for i, cmd := range cmds {
+		if cmd == nil {
+			errs[i] = append(errs[i], &ValidationError{
+				Message: "meme is missing",
+			})
+			continue
+		}
+
+		errs[i] = append(errs[i], validateMemeFields(cmd)...)
+		errs[i] = append(errs[i], validateOverlays(cmd.Overlays)...)
+
+		for j, o := range cmd.Overlays {
+			if stickerKey, err := datastore.DecodeKey(o.StickerID); err == nil && stickerKey.Kind() == StickerKind {
+				refs.stickers = append(refs.stickers, entityReference{
+					key:   stickerKey,
+					cmd:   i,
+					field: fmt.Sprintf("overlays[%d].sticker_id", j),
+				})
+			}
+		}
+
+		// fonts missing in registry may be uploaded fonts not loaded yet
+		if _, ok := Fonts.Font(cmd.FontID); cmd.FontID != "" && !ok {
+			if fontIDPattern.MatchString(cmd.FontID) {
+				refs.fonts = append(refs.fonts, entityReference{
+					id:    cmd.FontID,
+					cmd:   i,
+					field: "font_id",
+				})
+			} else {
+				errs[i] = append(errs[i], &ValidationError{
+					Field:   "font_id",
+					Message: "font id is invalid",
+				})
+			}
+		}
+
+		// uploaded template file replaces template id and panels
+		if templateFile {
+			if len(cmd.Panels) > 0 || cmd.Composition != "" {
+				errs[i] = append(errs[i], &ValidationError{
+					Field:   "panels",
+					Message: "panels can't be combined with template file",
+				})
+			}
+			if cmd.TemplateID != "" {
+				errs[i] = append(errs[i], &ValidationError{
+					Field:   "template_id",
+					Message: "template id can't be combined with template file",
+				})
+			}
+			continue
+		}
+
+		// composed memes have templates in panels
+		if len(cmd.Panels) > 0 || cmd.Composition != "" {
+			for j, p := range cmd.Panels {
+				field := fmt.Sprintf("panels[%d].template_id", j)
+				if templateKey, err := datastore.DecodeKey(p.TemplateID); err == nil && templateKey.Kind() == TemplateKind {
+					refs.templates = append(refs.templates, entityReference{
+						key:   templateKey,
+						cmd:   i,
+						field: field,
+					})
+				} else if p.TemplateID != "" {
+					errs[i] = append(errs[i], &ValidationError{
+						Field:   field,
+						Message: "template id is invalid",
+					})
+				}
+			}
+			continue
+		}
+
+		if cmd.TemplateID == "" {
+			errs[i] = append(errs[i], &ValidationError{
+				Field:   "template_id",
+				Message: "template id is required",
+			})
+			continue
+		}
+
+		templateKey, err := datastore.DecodeKey(cmd.TemplateID)
+		if err != nil || templateKey.Kind() != TemplateKind {
+			errs[i] = append(errs[i], &ValidationError{
+				Field:   "template_id",
+				Message: "template id is invalid",
+			})
+			continue
+		}
+
+		refs.templates = append(refs.templates, entityReference{
+			key:   templateKey,
+			cmd:   i,
+			field: "template_id",
+		})
+	}
+
+	return errs, refs
+}
+
+// missingEntities gets entities in single call and returns indexes of keys
+// which don't exist in datastore.
+func missingEntities(ctx context.Context, keys []*datastore.Key, dst interface{}) ([]int, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	err := datastore.GetMulti(ctx, keys, dst)
+	if err == nil {
+		return nil, nil
+	}
+
+	me, ok := err.(appengine.MultiError)
+	if !ok {
+		return nil, err
+	}
+
+	var missing []int
+	for i, err := range me {
+		if err == nil {
+			continue
+		}
+
+		if err != datastore.ErrNoSuchEntity {
+			return nil, err
+		}
+
+		missing = append(missing, i)
+	}
+
+	return missing, nil
+}
+
+// validateCaptions checks that at least one caption or text box is present
+// and that captions are within length and character limits.
+func validateCaptions(cmd *CreateMemeCommand) []*ValidationError {
+	var errs []*ValidationError
+
+	hasText := strings.TrimSpace(cmd.Top) != "" || strings.TrimSpace(cmd.Bottom) != ""
+	for _, box := range cmd.TextBoxes {
+		hasText = hasText || strings.TrimSpace(box.Text) != ""
+	}
+
+	if !hasText {
+		errs = append(errs, &ValidationError{
+			Field:   "top",
+			Message: "at least one of top or bottom caption or text box is required",
+		})
+	}
+
+	for _, caption := range []struct {
+		field string
+		text  string
+	}{
+		{"top", cmd.Top},
+		{"bottom", cmd.Bottom},
+	} {
+		if err := validateCaption(caption.text); err != "" {
+			errs = append(errs, &ValidationError{
+				Field:   caption.field,
+				Message: err,
+			})
+		}
+	}
+
+	return errs
+}
+
+// validateCaption returns description of problem with caption text or empty
+// string when caption is valid.
+func validateCaption(text string) string {
+	if !utf8.ValidString(text) {
+		return "caption is not valid UTF-8"
+	}
+
+	if n := utf8.RuneCountInString(text); n > MaxCaptionLength {
+		return fmt.Sprintf("caption is %d characters long, maximum is %d", n, MaxCaptionLength)
+	}
+
+	for _, r := range text {
+		if unicode.IsControl(r) || !unicode.IsPrint(r) && !unicode.IsSpace(r) && !unicode.Is(unicode.Cf, r) {
+			return fmt.Sprintf("caption contains unsupported character %U", r)
+		}
+	}
+
+	return ""
+}
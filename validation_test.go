@@ -0,0 +1,69 @@
+package memecreator
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// Encoded keys of app dev~memecreator with numeric id.
+const (
+	testTemplateID = "ag9kZXZ-bWVtZWNyZWF0b3JyFQsSCFRlbXBsYXRlGICAgICAgIAKDA"
+	testStickerID  = "ag9kZXZ-bWVtZWNyZWF0b3JyFAsSB1N0aWNrZXIYgICAgICAgAoM"
+	testMemeID     = "ag9kZXZ-bWVtZWNyZWF0b3JyEQsSBE1lbWUYgICAgICAgAoM"
+)
+
+func TestTestKeys(t *testing.T) {
+	for id, kind := range map[string]string{
+		testTemplateID: TemplateKind,
+		testStickerID:  StickerKind,
+		testMemeID:     MemeKind,
+	} {
+		if key, err := datastore.DecodeKey(id); err != nil || key.Kind() != kind {
+			t.Errorf("key %s is %v with error %v, want %s key", id, key, err, kind)
+		}
+	}
+}
+
+func TestCheckCreateMemeCommands(t *testing.T) {
+	sticker := []OverlaySpec{{StickerID: testStickerID, X: 0.5, Y: 0.5}}
+	wrongSticker := []OverlaySpec{{StickerID: testTemplateID, X: 0.5, Y: 0.5}}
+
+	for _, tt := range []struct {
+		name         string
+		cmd          *CreateMemeCommand
+		templateFile bool
+		errs         int
+		field        string
+		refs         int
+	}{
+		{"valid", &CreateMemeCommand{TemplateID: testTemplateID, Top: "TOP"}, false, 0, "", 1},
+		{"bottom only", &CreateMemeCommand{TemplateID: testTemplateID, Bottom: "BOTTOM"}, false, 0, "", 1},
+		{"missing", nil, false, 1, "", 0},
+		{"no template", &CreateMemeCommand{Top: "TOP"}, false, 1, "template_id", 0},
+		{"malformed template", &CreateMemeCommand{TemplateID: "drake", Top: "TOP"}, false, 1, "template_id", 0},
+		{"wrong kind", &CreateMemeCommand{TemplateID: testMemeID, Top: "TOP"}, false, 1, "template_id", 0},
+		{"empty captions", &CreateMemeCommand{TemplateID: testTemplateID, Top: " ", Bottom: "  "}, false, 1, "top", 1},
+		{"long caption", &CreateMemeCommand{TemplateID: testTemplateID, Top: strings.Repeat("A", MaxCaptionLength+1)}, false, 1, "top", 1},
+		{"max caption", &CreateMemeCommand{TemplateID: testTemplateID, Top: strings.Repeat("Ж", MaxCaptionLength)}, false, 0, "", 1},
+		{"control character", &CreateMemeCommand{TemplateID: testTemplateID, Top: "TOP", Bottom: "A\x00B"}, false, 1, "bottom", 1},
+		{"invalid UTF-8", &CreateMemeCommand{TemplateID: testTemplateID, Top: "\xff"}, false, 1, "top", 1},
+		{"sticker", &CreateMemeCommand{TemplateID: testTemplateID, Top: "TOP", Overlays: sticker}, false, 0, "", 2},
+		{"wrong sticker kind", &CreateMemeCommand{TemplateID: testTemplateID, Top: "TOP", Overlays: wrongSticker}, false, 1, "overlays[0].sticker_id", 1},
+		{"uploaded font", &CreateMemeCommand{TemplateID: testTemplateID, Top: "TOP", FontID: "comic-neue"}, false, 0, "", 2},
+		{"invalid font", &CreateMemeCommand{TemplateID: testTemplateID, Top: "TOP", FontID: "Not A Font"}, false, 1, "font_id", 1},
+		{"template file", &CreateMemeCommand{Top: "TOP"}, true, 0, "", 0},
+		{"template file with id", &CreateMemeCommand{TemplateID: testTemplateID, Top: "TOP"}, true, 1, "template_id", 0},
+	} {
+		errs, refs := checkCreateMemeCommands([]*CreateMemeCommand{tt.cmd}, tt.templateFile)
+
+		if len(errs[0]) != tt.errs || tt.errs > 0 && errs[0][0].Field != tt.field {
+			t.Errorf("%s command has errors %+v, want %d %q errors", tt.name, errs[0], tt.errs, tt.field)
+		}
+
+		if n := len(refs.templates) + len(refs.fonts) + len(refs.stickers); n != tt.refs {
+			t.Errorf("%s command has %d references, want %d", tt.name, n, tt.refs)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package memecreator
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+
+	"cloud.google.com/go/storage"
+	xdraw "golang.org/x/image/draw"
+)
+
+// VariantOriginal is name of variant with meme at template resolution.
+const VariantOriginal = "original"
+
+// MemeVariant is resized copy of rendered meme stored next to original.
+type MemeVariant struct {
+	Name  string
+	Width int
+}
+
+// MemeVariants are variants which can be stored for rendered meme, memes
+// store variants listed in request or all of them. Memes narrower than
+// variant are not upscaled and such variant is not stored.
+var MemeVariants = []MemeVariant{
+	{Name: "thumb", Width: 256},
+	{Name: "medium", Width: 640},
+}
+
+// memeVariants returns variants with given names, all variants are returned
+// when there are no names.
+func memeVariants(names []string) []MemeVariant {
+	if len(names) == 0 {
+		return MemeVariants
+	}
+
+	var variants []MemeVariant
+	for _, v := range MemeVariants {
+		for _, name := range names {
+			if v.Name == name {
+				variants = append(variants, v)
+				break
+			}
+		}
+	}
+
+	return variants
+}
+
+// validateVariants checks that all requested variants exist.
+func validateVariants(cmd *CreateMemeCommand) []*ValidationError {
+	var errs []*ValidationError
+
+	for i, name := range cmd.Variants {
+		if len(memeVariants([]string{name})) == 0 {
+			errs = append(errs, &ValidationError{
+				Field:   fmt.Sprintf("variants[%d]", i),
+				Message: fmt.Sprintf("variant %q does not exist", name),
+			})
+		}
+	}
+
+	return errs
+}
+
+// resizeToWidth scales image down to width keeping aspect ratio.
+func resizeToWidth(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := newCanvas(image.Rect(0, 0, width, height), isHighPrecision(img))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+
+	return dst
+}
+
+// variantObjectName returns name of cloud storage object with meme variant.
+func (o OutputFormat) variantObjectName(memeID, variant string) string {
+	if variant == VariantOriginal {
+		return o.objectName(memeID)
+	}
+
+	return fmt.Sprintf("%s-%s.%s", memeID, variant, o.extension())
+}
+
+// storeMemeImage encodes image in output format to publicly readable cloud
+// storage object and returns its size in bytes.
+func storeMemeImage(ctx context.Context, bucket *storage.BucketHandle, name string, output OutputFormat, img image.Image) (int64, error) {
+	return storeMemeObject(ctx, bucket, name, output.contentType(), func(w io.Writer) error {
+		return output.encoder()(w, img)
+	})
+}
+
+// storeMemeObject writes publicly readable cloud storage object with rendered
+// meme and returns its size in bytes.
+func storeMemeObject(ctx context.Context, bucket *storage.BucketHandle, name, contentType string, write func(w io.Writer) error) (int64, error) {
+	cso := bucket.Object(name)
+
+	csow := cso.NewWriter(ctx)
+	csow.ContentType = contentType
+	if err := write(csow); err != nil {
+		csow.Close()
+		return 0, fmt.Errorf("copying rendered file to cloud storage failed, error: %s", err)
+	}
+
+	if err := csow.Close(); err != nil {
+		return 0, fmt.Errorf("closing rendered file storage writer failed, error: %s", err)
+	}
+
+	if err := cso.ACL().Set(ctx, storage.AllUsers, storage.RoleReader); err != nil {
+		return 0, fmt.Errorf("setting acl on meme cloud storage object failed, error: %s", err)
+	}
+
+	return csow.Attrs().Size, nil
+}
+
+// storeMemeVariants stores rendered meme together with its requested variants
+// not wider than it and returns names of stored variants and size of original.
+func storeMemeVariants(ctx context.Context, bucket *storage.BucketHandle, memeID string, output OutputFormat, img image.Image, requested []string) ([]string, int64, error) {
+	size, err := storeMemeImage(ctx, bucket, output.objectName(memeID), output, img)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	variants := []string{VariantOriginal}
+	for _, v := range memeVariants(requested) {
+		if v.Width >= img.Bounds().Dx() {
+			continue
+		}
+
+		if _, err := storeMemeImage(ctx, bucket, output.variantObjectName(memeID, v.Name), output, resizeToWidth(img, v.Width)); err != nil {
+			return nil, 0, fmt.Errorf("storing %s variant failed, error: %s", v.Name, err)
+		}
+		variants = append(variants, v.Name)
+	}
+
+	return variants, size, nil
+}
+
+// setURLs sets public urls of meme and its stored variants, memes rendered
+// before variants were introduced have only original.
+func (mr *MemeResponse) setURLs() {
+	mr.PublicURL = fmt.Sprintf("%s/%s", MemePublicURLPrefix, mr.Output.objectName(mr.ID))
+
+	names := mr.VariantNames
+	if len(names) == 0 && mr.Status == MemeStatusDone {
+		names = []string{VariantOriginal}
+	}
+
+	mr.Variants = make(map[string]string, len(names))
+	for _, v := range names {
+		mr.Variants[v] = fmt.Sprintf("%s/%s", MemePublicURLPrefix, mr.Output.variantObjectName(mr.ID, v))
+	}
+}
@@ -0,0 +1,67 @@
+package memecreator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResizeToWidth(t *testing.T) {
+	img := resizeToWidth(testTemplate(1280, 720), 256)
+
+	if size := img.Bounds().Size(); size.X != 256 || size.Y != 144 {
+		t.Errorf("resized image is %v, want 256x144", size)
+	}
+}
+
+func TestMemeResponseURLs(t *testing.T) {
+	mr := &MemeResponse{
+		ID: "abc",
+		Meme: Meme{
+			Status:       MemeStatusDone,
+			Output:       OutputFormat{Format: FormatJPEG},
+			VariantNames: []string{VariantOriginal, "thumb"},
+		},
+	}
+	mr.setURLs()
+
+	if want := MemePublicURLPrefix + "/abc.jpg"; mr.PublicURL != want || mr.Variants[VariantOriginal] != want {
+		t.Errorf("original url is %q, variant %q, want %q", mr.PublicURL, mr.Variants[VariantOriginal], want)
+	}
+
+	if want := MemePublicURLPrefix + "/abc-thumb.jpg"; mr.Variants["thumb"] != want {
+		t.Errorf("thumb url is %q, want %q", mr.Variants["thumb"], want)
+	}
+
+	if _, ok := mr.Variants["medium"]; ok {
+		t.Errorf("medium variant is listed but was not stored")
+	}
+}
+
+func TestMemeVariants(t *testing.T) {
+	for _, tt := range []struct {
+		names []string
+		want  []string
+	}{
+		{nil, []string{"thumb", "medium"}},
+		{[]string{"thumb"}, []string{"thumb"}},
+		{[]string{"medium", "thumb"}, []string{"thumb", "medium"}},
+		{[]string{"poster"}, nil},
+	} {
+		var got []string
+		for _, v := range memeVariants(tt.names) {
+			got = append(got, v.Name)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("variants %v are %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	errs := validateVariants(&CreateMemeCommand{Variants: []string{"thumb", "poster"}})
+
+	if len(errs) != 1 || errs[0].Field != "variants[1]" {
+		t.Errorf("variants errors are %+v, want error of variants[1]", errs)
+	}
+}
@@ -0,0 +1,26 @@
+package memecreator
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestLastTaskRetry(t *testing.T) {
+	for _, tt := range []struct {
+		retries string
+		want    bool
+	}{
+		{"", false},
+		{"0", false},
+		{strconv.Itoa(MemeTaskRetryLimit - 1), false},
+		{strconv.Itoa(MemeTaskRetryLimit), true},
+	} {
+		r := httptest.NewRequest("POST", "/worker", nil)
+		r.Header.Set("X-AppEngine-TaskRetryCount", tt.retries)
+
+		if got := lastTaskRetry(r); got != tt.want {
+			t.Errorf("task with %q retries is last %t, want %t", tt.retries, got, tt.want)
+		}
+	}
+}